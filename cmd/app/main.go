@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -11,11 +13,19 @@ import (
 
 	"github.com/Gezubov/user_service/config"
 	"github.com/Gezubov/user_service/internal/controller"
+	"github.com/Gezubov/user_service/internal/infrastructure/breach"
 	"github.com/Gezubov/user_service/internal/infrastructure/db"
+	"github.com/Gezubov/user_service/internal/infrastructure/jwtkeys"
+	"github.com/Gezubov/user_service/internal/infrastructure/mailer"
 	"github.com/Gezubov/user_service/internal/middlewares"
+	"github.com/Gezubov/user_service/internal/models"
 	"github.com/Gezubov/user_service/internal/service"
 	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/Gezubov/user_service/pkg/passhash"
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
@@ -28,15 +38,77 @@ func main() {
 
 	ctx := context.Background()
 
-	slog.Info("Initializing database...")
-	db.InitDB(ctx, &config.GetConfig().Database)
-	database := db.GetDB()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(ctx, os.Args[2:]); err != nil {
+			slog.Error("Migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	autoMigrate := flag.Bool("auto-migrate", config.GetConfig().Database.AutoMigrate,
+		"apply pending migrations before starting the server")
+	flag.Parse()
+
+	repos, err := newRepositories(ctx, config.GetConfig(), *autoMigrate)
+	if err != nil {
+		slog.Error("Unable to initialize storage", "error", err)
+		os.Exit(1)
+	}
+
+	go runEvery(ctx, time.Hour, repos.deleteExpiredTokens)
+
+	revocations := service.NewRevocationList(repos.revocations,
+		time.Duration(config.GetConfig().JWT.RevocationCacheTTL)*time.Second)
+	authCfg := config.GetConfig().Auth
+	throttle := service.NewLoginThrottle(repos.loginFailures, service.LockoutPolicy{
+		AccountThreshold: authCfg.LockoutAccountThreshold,
+		IPThreshold:      authCfg.LockoutIPThreshold,
+		Window:           time.Duration(authCfg.LockoutWindow) * time.Second,
+		BaseDuration:     time.Duration(authCfg.LockoutBaseDuration) * time.Second,
+		MaxDuration:      time.Duration(authCfg.LockoutMaxDuration) * time.Second,
+	})
+
+	mail, err := mailer.New(&config.GetConfig().Mail)
+	if err != nil {
+		slog.Error("Unable to configure mailer", "error", err)
+		os.Exit(1)
+	}
+
+	keys, err := jwtkeys.Load(&config.GetConfig().JWT)
+	if err != nil {
+		slog.Error("Unable to load JWT keys", "error", err)
+		os.Exit(1)
+	}
+	challengeKey, err := jwtkeys.LoadChallengeKey(&config.GetConfig().JWT)
+	if err != nil {
+		slog.Error("Unable to load JWT challenge secret", "error", err)
+		os.Exit(1)
+	}
 
-	userRepo := storage.NewUserStorage(ctx, database)
-	userService := service.NewUserService(ctx, userRepo)
+	passwordPolicy, err := newPasswordPolicy(&config.GetConfig().Password)
+	if err != nil {
+		slog.Error("Unable to load breached password corpus", "error", err)
+		os.Exit(1)
+	}
+
+	hasher, err := newPasswordHasher(&config.GetConfig().Password)
+	if err != nil {
+		slog.Error("Unable to configure password hashing", "error", err)
+		os.Exit(1)
+	}
+
+	rateLimits, err := newRateLimitStore(ctx, &config.GetConfig().RateLimit, repos.database)
+	if err != nil {
+		slog.Error("Unable to configure rate limiting", "error", err)
+		os.Exit(1)
+	}
+
+	userService := service.NewUserService(ctx, repos.users, repos.tokens, repos.oneTimeTokens, revocations, throttle, passwordPolicy, hasher, mail, keys, challengeKey)
 	userController := controller.NewUserController(ctx, userService)
+	jwksController := controller.NewJWKSController(keys)
 
-	r := SetupRoutes(userController)
+	r := SetupRoutes(userController, jwksController, userService, rateLimits)
 
 	port := config.GetConfig().Server.Port
 	serverAddr := ":" + port
@@ -70,21 +142,154 @@ func main() {
 	db.CloseDB(ctx)
 }
 
-func SetupRoutes(userController *controller.UserController) *chi.Mux {
+func newPasswordPolicy(cfg *config.PasswordConfig) (*service.PasswordPolicy, error) {
+	policy := &service.PasswordPolicy{MinLength: cfg.MinLength, MinScore: cfg.MinScore}
+	if cfg.BreachedCorpusPath != "" {
+		corpus, err := breach.Open(cfg.BreachedCorpusPath)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = corpus
+	}
+	return policy, nil
+}
+
+// newPasswordHasher hashes with the configured algorithm and keeps the other
+// one around to verify hashes made before a switch.
+func newPasswordHasher(cfg *config.PasswordConfig) (*passhash.Chain, error) {
+	bcryptScheme := passhash.Bcrypt{Cost: cfg.BcryptCost}
+	argon2Scheme := passhash.Argon2id{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+	}
+
+	switch cfg.Hasher {
+	case "argon2id":
+		if err := argon2Scheme.Validate(); err != nil {
+			return nil, err
+		}
+		return passhash.NewChain(argon2Scheme, bcryptScheme), nil
+	case "bcrypt":
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return passhash.NewChain(bcryptScheme, argon2Scheme), nil
+	default:
+		return nil, fmt.Errorf("unknown password hasher %q", cfg.Hasher)
+	}
+}
+
+// newRateLimitStore picks the rate limiting backend. The Postgres one also
+// gets a background job pruning buckets that have been idle for a day, which
+// is longer than any policy period. database is nil unless the service keeps
+// its data in Postgres.
+func newRateLimitStore(ctx context.Context, cfg *config.RateLimitConfig, database *pgxpool.Pool) (middlewares.RateLimitStore, error) {
+	switch cfg.Driver {
+	case "", "memory":
+		return middlewares.NewMemoryRateLimitStore(), nil
+	case "postgres":
+		if database == nil {
+			return nil, fmt.Errorf("the postgres rate limit driver needs the Postgres storage")
+		}
+		store := storage.NewRateLimitStorage(ctx, database)
+		go runEvery(ctx, time.Hour, func(ctx context.Context) {
+			store.DeleteIdle(ctx, time.Now().Add(-24*time.Hour))
+		})
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit driver %q", cfg.Driver)
+	}
+}
+
+func SetupRoutes(
+	userController *controller.UserController,
+	jwksController *controller.JWKSController,
+	tokenValidator middlewares.TokenValidator,
+	rateLimits middlewares.RateLimitStore,
+) *chi.Mux {
 	r := chi.NewRouter()
+	if config.GetConfig().Server.TrustProxyHeaders {
+		r.Use(middleware.RealIP)
+	}
 	r.Use(middlewares.CorsMiddleware())
+	r.Use(middlewares.MaxBodySize(config.GetConfig().Server.MaxBodyBytes))
+
+	auth := middlewares.AuthMiddleware(tokenValidator, config.GetConfig().Auth.TokenSources)
+	optionalAuth := middlewares.OptionalAuthMiddleware(tokenValidator, config.GetConfig().Auth.TokenSources)
+	introspectionCfg := config.GetConfig().Introspection
+	clientAuth := middlewares.ClientAuthMiddleware(introspectionCfg.Clients, introspectionCfg.APIKeys)
+
+	// Anonymous endpoints that create accounts or send mail.
+	sensitiveLimit := middlewares.RateLimit(rateLimits, middlewares.RateLimitPolicy{
+		Name: "auth", Limit: 10, Period: time.Hour, Key: middlewares.RateLimitByIP,
+	})
+	mailLimit := middlewares.RateLimit(rateLimits, middlewares.RateLimitPolicy{
+		Name: "mail", Limit: 5, Period: time.Hour, Key: middlewares.RateLimitByUser,
+	})
+	publicReadLimit := middlewares.RateLimit(rateLimits, middlewares.RateLimitPolicy{
+		Name: "public-read", Limit: 60, Period: time.Minute, Key: middlewares.RateLimitByIP,
+	})
+	introspectionLimit := middlewares.RateLimit(rateLimits, middlewares.RateLimitPolicy{
+		Name: "introspection", Limit: 1000, Period: time.Minute, Key: middlewares.RateLimitByClient,
+	})
+
+	r.Get("/.well-known/jwks.json", jwksController.GetJWKS)
 
 	r.Route("/auth", func(r chi.Router) {
-		r.Post("/register", userController.Register)
+		r.With(sensitiveLimit).Post("/register", userController.Register)
 		r.Post("/login", userController.Login)
+		r.Post("/refresh", userController.Refresh)
+		r.With(auth).Post("/logout", userController.Logout)
+		r.With(auth).Post("/logout-all", userController.LogoutAll)
+		r.With(sensitiveLimit).Post("/password/forgot", userController.ForgotPassword)
+		r.With(sensitiveLimit).Post("/password/reset", userController.ResetPassword)
+		r.With(auth).Get("/me", userController.Me)
+		r.With(clientAuth, introspectionLimit).Post("/introspect", userController.Introspect)
+		r.Post("/verify-email", userController.VerifyEmail)
+		r.With(auth, mailLimit).Post("/verify-email/resend", userController.ResendVerification)
+
+		r.Route("/mfa", func(r chi.Router) {
+			r.With(auth).Post("/enroll", userController.EnrollMFA)
+			r.With(auth).Post("/confirm", userController.ConfirmMFA)
+			r.With(auth).Post("/disable", userController.DisableMFA)
+			r.Post("/verify", userController.VerifyMFA)
+		})
 	})
 
 	r.Route("/user", func(r chi.Router) {
-		r.Get("/{id}", userController.GetUser)
-		r.With(middlewares.AuthMiddleware).Patch("/{id}", userController.UpdateUser)
-		r.With(middlewares.AuthMiddleware).Delete("/{id}", userController.DeleteUser)
+		r.With(optionalAuth, publicReadLimit).Get("/{id}", userController.GetUser)
+		r.With(auth).Patch("/{id}", userController.UpdateUser)
+		r.With(auth).Delete("/{id}", userController.DeleteUser)
+		r.With(auth).Post("/{id}/password", userController.ChangePassword)
+	})
+	r.With(optionalAuth, publicReadLimit).Get("/users", userController.GetUsers)
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(auth, middlewares.RequireRole(models.RoleAdmin))
+
+		r.Get("/users", userController.AdminListUsers)
+		r.Patch("/users/{id}/role", userController.AdminChangeRole)
+		r.Post("/users/{id}/suspend", userController.AdminSuspendUser)
+		r.Post("/users/{id}/unsuspend", userController.AdminUnsuspendUser)
+		r.Post("/users/{id}/force-password-reset", userController.AdminForcePasswordReset)
+		r.Post("/users/{id}/revoke-sessions", userController.AdminRevokeSessions)
+		r.Post("/users/{id}/unlock", userController.AdminUnlockUser)
 	})
-	r.Get("/users", userController.GetUsers)
 
 	return r
 }
+
+// runEvery calls fn every interval until ctx is done.
+func runEvery(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn(ctx)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/infrastructure/db"
+)
+
+const migrateUsage = `usage: app migrate <command>
+
+commands:
+  up      apply all pending migrations
+  down    roll back the most recent migration
+  status  list migrations and whether they are applied
+  redo    roll back the most recent migration and apply it again`
+
+// runMigrate implements "app migrate ...", which applies the migrations
+// embedded in the binary and exits without starting the server.
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return fmt.Errorf("expected exactly one migrate command")
+	}
+	return db.Migrate(ctx, &config.GetConfig().Database, args[0])
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/infrastructure/db"
+	"github.com/Gezubov/user_service/internal/service"
+	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/Gezubov/user_service/internal/storage/memory"
+	"github.com/Gezubov/user_service/internal/storage/sqlite"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// repositories are the storages the service runs on.
+type repositories struct {
+	users         service.UserStorage
+	tokens        service.TokenStorage
+	oneTimeTokens service.OneTimeTokenStorage
+	revocations   service.RevocationStorage
+	loginFailures service.LoginFailureStorage
+	// database is nil unless the data is kept in Postgres.
+	database *pgxpool.Pool
+}
+
+// newRepositories sets up the configured storage backend, connecting to the
+// database and applying migrations first when it needs one.
+func newRepositories(ctx context.Context, cfg *config.Config, autoMigrate bool) (*repositories, error) {
+	switch cfg.Storage.Driver {
+	case "memory":
+		slog.Warn("Using in-memory storage, all data will be lost on restart")
+		mem := memory.New()
+		return &repositories{
+			users:         memory.NewUserStorage(ctx, mem),
+			tokens:        memory.NewTokenStorage(ctx, mem),
+			oneTimeTokens: memory.NewOneTimeTokenStorage(ctx, mem),
+			revocations:   memory.NewRevocationStorage(ctx, mem),
+			loginFailures: memory.NewLoginFailureStorage(ctx, mem),
+		}, nil
+	case "", "database":
+		slog.Info("Initializing database...")
+		if err := db.InitDB(ctx, &cfg.Database); err != nil {
+			return nil, err
+		}
+		if autoMigrate {
+			slog.Info("Applying migrations...")
+			if err := db.Migrate(ctx, &cfg.Database, db.MigrateUp); err != nil {
+				return nil, fmt.Errorf("unable to apply migrations: %w", err)
+			}
+		}
+
+		if cfg.Database.Driver == "sqlite" {
+			database := db.GetSQLite()
+			return &repositories{
+				users:         sqlite.NewUserStorage(ctx, database),
+				tokens:        sqlite.NewTokenStorage(ctx, database),
+				oneTimeTokens: sqlite.NewOneTimeTokenStorage(ctx, database),
+				revocations:   sqlite.NewRevocationStorage(ctx, database),
+				loginFailures: sqlite.NewLoginFailureStorage(ctx, database),
+			}, nil
+		}
+
+		database := db.GetDB()
+		return &repositories{
+			users:         storage.NewUserStorage(ctx, database),
+			tokens:        storage.NewTokenStorage(ctx, database),
+			oneTimeTokens: storage.NewOneTimeTokenStorage(ctx, database),
+			revocations:   storage.NewRevocationStorage(ctx, database),
+			loginFailures: storage.NewLoginFailureStorage(ctx, database),
+			database:      database,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
+
+// deleteExpiredTokens prunes tokens that are rejected for their expiry alone,
+// so that the token tables do not grow without bound. Errors are logged by
+// the storages and the next run tries again.
+func (r *repositories) deleteExpiredTokens(ctx context.Context) {
+	now := time.Now()
+	r.tokens.DeleteExpired(ctx, now)
+	r.oneTimeTokens.DeleteExpired(ctx, now)
+	r.revocations.DeleteExpired(ctx, now)
+}
@@ -9,25 +9,161 @@ import (
 
 type Config struct {
 	Server   ServerConfig   `envPrefix:"APP_"`
+	Storage  StorageConfig  `envPrefix:"STORAGE_"`
 	Database DatabaseConfig `envPrefix:"DB_"`
 	JWT      JWTConfig      `envPrefix:"JWT_"`
+	Auth     AuthConfig     `envPrefix:"AUTH_"`
+	Password PasswordConfig `envPrefix:"PASSWORD_"`
+	Mail     MailConfig     `envPrefix:"MAIL_"`
+
+	Introspection IntrospectionConfig `envPrefix:"INTROSPECTION_"`
+	RateLimit     RateLimitConfig     `envPrefix:"RATE_LIMIT_"`
 }
 
 type ServerConfig struct {
 	Port string `env:"PORT"`
+	// Base URL of the web client, used to build links sent by mail.
+	FrontendURL string `env:"FRONTEND_URL" envDefault:"http://localhost:5173"`
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For/X-Real-IP.
+	// Only enable it behind a proxy that sets these headers.
+	TrustProxyHeaders bool `env:"TRUST_PROXY_HEADERS" envDefault:"false"`
+	// MaxBodyBytes caps the size of request bodies.
+	MaxBodyBytes int64 `env:"MAX_BODY_BYTES" envDefault:"65536"`
+}
+
+type StorageConfig struct {
+	// Driver is "database" to keep data in the database configured by the
+	// DB_ settings, or "memory" to run without one. In-memory data is lost
+	// on restart.
+	Driver string `env:"DRIVER" envDefault:"database"`
 }
 
 type DatabaseConfig struct {
+	// Driver is "postgres" or "sqlite". SQLite keeps everything in the file
+	// at SQLitePath and ignores the connection and pool settings below.
+	Driver     string `env:"DRIVER" envDefault:"postgres"`
+	SQLitePath string `env:"SQLITE_PATH" envDefault:"user_service.db"`
+
 	Host     string `env:"HOST"`
 	Port     string `env:"PORT"`
 	Username string `env:"USER"`
 	Password string `env:"PASSWORD"`
 	Database string `env:"NAME"`
+	// SSLMode is passed to libpq-style sslmode: disable, prefer, require,
+	// verify-ca or verify-full.
+	SSLMode string `env:"SSL_MODE" envDefault:"disable"`
+
+	MaxConns int32 `env:"MAX_CONNS" envDefault:"10"`
+	MinConns int32 `env:"MIN_CONNS" envDefault:"0"`
+	// Connection lifetimes, in seconds.
+	MaxConnLifetime int `env:"MAX_CONN_LIFETIME" envDefault:"3600"`
+	MaxConnIdleTime int `env:"MAX_CONN_IDLE_TIME" envDefault:"1800"`
+	// StatementTimeout aborts queries running longer than this many
+	// milliseconds. Zero leaves the server default.
+	StatementTimeout int `env:"STATEMENT_TIMEOUT" envDefault:"30000"`
+
+	// ConnectAttempts bounds how often startup tries to reach the database,
+	// waiting ConnectBackoff seconds after the first failure and doubling
+	// the wait after each further one.
+	ConnectAttempts int `env:"CONNECT_ATTEMPTS" envDefault:"10"`
+	ConnectBackoff  int `env:"CONNECT_BACKOFF" envDefault:"1"`
+
+	// AutoMigrate applies pending migrations on startup. The -auto-migrate
+	// flag overrides it.
+	AutoMigrate bool `env:"AUTO_MIGRATE" envDefault:"false"`
 }
 
 type JWTConfig struct {
-	Secret     string `env:"SECRET"`
-	Expiration int    `env:"EXPIRATION"`
+	// Secret signs HS256 tokens when no signing keys are configured. Once
+	// keys are in use, it only verifies HS256 tokens issued before the switch
+	// and should be removed after they have expired.
+	Secret string `env:"SECRET"`
+	// SigningKeys maps key IDs to PEM private keys (RSA or Ed25519), e.g.
+	// "2026-10=/keys/2026-10.pem,2026-04=/keys/2026-04.pem".
+	SigningKeys map[string]string `env:"SIGNING_KEYS" envKeyValSeparator:"="`
+	// VerificationKeys maps key IDs to PEM public keys of retired keys whose
+	// tokens must still be accepted.
+	VerificationKeys map[string]string `env:"VERIFICATION_KEYS" envKeyValSeparator:"="`
+	// ActiveKeyID selects the signing key for new tokens. It may be omitted
+	// when there is only one signing key.
+	ActiveKeyID string `env:"ACTIVE_KEY_ID"`
+	// ChallengeSecret signs two-factor challenges. It must be at least 32
+	// bytes, differ from Secret and be shared by every instance. When empty,
+	// each instance generates its own on startup.
+	ChallengeSecret string `env:"CHALLENGE_SECRET"`
+
+	Expiration        int `env:"EXPIRATION"`
+	RefreshExpiration int `env:"REFRESH_EXPIRATION" envDefault:"2592000"`
+	// How long, in seconds, an instance may trust a cached "not revoked"
+	// answer before asking the database again.
+	RevocationCacheTTL int `env:"REVOCATION_CACHE_TTL" envDefault:"5"`
+}
+
+type AuthConfig struct {
+	// TokenSources is the order in which requests are searched for an access
+	// token: "header" (Authorization: Bearer) and/or "cookie".
+	TokenSources []string `env:"TOKEN_SOURCES" envDefault:"header,cookie"`
+
+	PasswordResetExpiration     int `env:"PASSWORD_RESET_EXPIRATION" envDefault:"3600"`
+	EmailVerificationExpiration int `env:"EMAIL_VERIFICATION_EXPIRATION" envDefault:"86400"`
+	// MFAIssuer is the account issuer shown in authenticator apps.
+	MFAIssuer              string `env:"MFA_ISSUER" envDefault:"user_service"`
+	MFAChallengeExpiration int    `env:"MFA_CHALLENGE_EXPIRATION" envDefault:"300"`
+
+	// Failed logins allowed per account and per client IP within
+	// LockoutWindow seconds before a lock kicks in. Zero disables the check.
+	LockoutAccountThreshold int `env:"LOCKOUT_ACCOUNT_THRESHOLD" envDefault:"5"`
+	LockoutIPThreshold      int `env:"LOCKOUT_IP_THRESHOLD" envDefault:"20"`
+	LockoutWindow           int `env:"LOCKOUT_WINDOW" envDefault:"900"`
+	// The first lock lasts LockoutBaseDuration seconds and doubles with
+	// every further failure, up to LockoutMaxDuration.
+	LockoutBaseDuration int `env:"LOCKOUT_BASE_DURATION" envDefault:"60"`
+	LockoutMaxDuration  int `env:"LOCKOUT_MAX_DURATION" envDefault:"3600"`
+}
+
+type PasswordConfig struct {
+	MinLength int `env:"MIN_LENGTH" envDefault:"10"`
+	// MinScore is the minimum strength on a 0 (trivial) to 4 (strong) scale.
+	MinScore int `env:"MIN_SCORE" envDefault:"3"`
+	// BreachedCorpusPath points to a Have I Been Pwned style SHA-1 corpus:
+	// either a directory of range files named by hash prefix, or a single
+	// "HASH:COUNT" file. Leave empty to skip the check.
+	BreachedCorpusPath string `env:"BREACHED_CORPUS_PATH"`
+
+	// Hasher is the algorithm for new hashes: "argon2id" or "bcrypt". Hashes
+	// made with the other one, or with weaker parameters, are upgraded on the
+	// next successful login.
+	Hasher     string `env:"HASHER" envDefault:"argon2id"`
+	BcryptCost int    `env:"BCRYPT_COST" envDefault:"10"`
+	// Argon2Memory is in KiB.
+	Argon2Memory      uint32 `env:"ARGON2_MEMORY" envDefault:"65536"`
+	Argon2Iterations  uint32 `env:"ARGON2_ITERATIONS" envDefault:"3"`
+	Argon2Parallelism uint8  `env:"ARGON2_PARALLELISM" envDefault:"2"`
+}
+
+type MailConfig struct {
+	// Driver is "smtp" or "log".
+	Driver   string `env:"DRIVER" envDefault:"log"`
+	Host     string `env:"HOST"`
+	Port     string `env:"PORT" envDefault:"587"`
+	Username string `env:"USERNAME"`
+	Password string `env:"PASSWORD"`
+	From     string `env:"FROM"`
+	// LogPath is where the log driver appends messages; empty means stdout.
+	LogPath string `env:"LOG_PATH"`
+}
+
+type RateLimitConfig struct {
+	// Driver is "memory" for a single instance or "postgres" to share limits
+	// between instances.
+	Driver string `env:"DRIVER" envDefault:"memory"`
+}
+
+// IntrospectionConfig lists the services allowed to call /auth/introspect.
+type IntrospectionConfig struct {
+	// Clients maps client IDs to secrets for HTTP Basic authentication.
+	Clients map[string]string `env:"CLIENTS" envKeyValSeparator:"="`
+	APIKeys []string          `env:"API_KEYS"`
 }
 
 var Cfg Config
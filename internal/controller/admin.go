@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Gezubov/user_service/internal/middlewares"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/problem"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidRole = problem.New(http.StatusBadRequest, problem.CodeInvalidRole, "invalid role")
+var ErrCannotModifySelf = problem.New(http.StatusConflict, problem.CodeCannotModifySelf, "admins cannot change their own role or suspend themselves")
+
+type changeRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (c *UserController) AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseUserFilter(r.URL.Query(), true)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	page, err := c.userService.ListUsers(r.Context(), filter)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newUserPageResponse(page, models.NewAdminUserResponse))
+}
+
+func (c *UserController) AdminChangeRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input changeRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, ErrInvalidRequestBody)
+		return
+	}
+
+	if err := c.userService.ChangeRole(r.Context(), id, input.Role); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *UserController) AdminSuspendUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.userService.SuspendUser(r.Context(), id); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *UserController) AdminUnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.userService.UnsuspendUser(r.Context(), id); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *UserController) AdminForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, ErrInvalidUserID)
+		return
+	}
+
+	if err := c.userService.ForcePasswordReset(r.Context(), id); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *UserController) AdminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, ErrInvalidUserID)
+		return
+	}
+
+	if err := c.userService.RevokeSessions(r.Context(), id); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminUnlockUser lifts a lockout caused by failed logins.
+func (c *UserController) AdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, ErrInvalidUserID)
+		return
+	}
+
+	if err := c.userService.UnlockUser(r.Context(), id); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminTargetUser parses the {id} URL parameter and refuses requests where an
+// admin targets their own account, so nobody can lock themselves out.
+func adminTargetUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, ErrInvalidUserID)
+		return uuid.Nil, false
+	}
+
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, ErrUnauthorized)
+		return uuid.Nil, false
+	}
+	if claims.UserUUID == id {
+		problem.Write(w, r, ErrCannotModifySelf)
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
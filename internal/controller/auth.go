@@ -0,0 +1,294 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Gezubov/user_service/internal/middlewares"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/problem"
+)
+
+const (
+	accessTokenCookie  = middlewares.AccessTokenCookie
+	refreshTokenCookie = "refresh_token"
+	// The refresh token is only ever needed by the /auth endpoints, so it is
+	// not sent along with every other request.
+	refreshTokenPath = "/auth"
+)
+
+var ErrInvalidRefreshToken = problem.New(http.StatusUnauthorized, problem.CodeInvalidRefreshToken, "invalid refresh token")
+var ErrEmailRequired = problem.New(http.StatusBadRequest, problem.CodeEmailRequired, "email is required")
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Refresh takes the refresh token from its cookie or, for clients that do not
+// keep cookies, from the request body. The new pair goes back the same way.
+func (c *UserController) Refresh(w http.ResponseWriter, r *http.Request) {
+	refreshToken, fromBody := refreshTokenFromRequest(r)
+	if refreshToken == "" {
+		problem.Write(w, r, ErrInvalidRefreshToken)
+		return
+	}
+
+	tokens, err := c.userService.Refresh(r.Context(), refreshToken)
+	if err != nil {
+		if !fromBody {
+			clearAuthCookies(w)
+		}
+		problem.Write(w, r, ErrInvalidRefreshToken)
+		return
+	}
+
+	if fromBody {
+		writeTokenResponse(w, "Token refreshed", nil, tokens)
+		return
+	}
+
+	if err := setAuthCookies(w, tokens); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Token refreshed",
+	})
+}
+
+func (c *UserController) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, ErrUnauthorized)
+		return
+	}
+
+	refreshToken, _ := refreshTokenFromRequest(r)
+
+	if err := c.userService.Logout(r.Context(), claims, refreshToken); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *UserController) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, ErrUnauthorized)
+		return
+	}
+
+	if err := c.userService.LogoutAll(r.Context(), claims.UserUUID); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *UserController) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, ErrInvalidRequestBody)
+		return
+	}
+	if input.Email == "" {
+		problem.Write(w, r, ErrEmailRequired)
+		return
+	}
+
+	if err := c.userService.RequestPasswordReset(r.Context(), input.Email); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "If the address is registered, a password reset link has been sent",
+	})
+}
+
+func (c *UserController) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, ErrInvalidRequestBody)
+		return
+	}
+
+	if err := c.userService.ResetPassword(r.Context(), input.Token, input.Password); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *UserController) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var input verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, ErrInvalidRequestBody)
+		return
+	}
+
+	if err := c.userService.VerifyEmail(r.Context(), input.Token); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *UserController) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, ErrUnauthorized)
+		return
+	}
+
+	if err := c.userService.ResendVerification(r.Context(), claims.UserUUID); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Verification email sent",
+	})
+}
+
+// refreshTokenFromRequest prefers the cookie and falls back to a JSON body.
+// The second result reports whether the token came from the body.
+func refreshTokenFromRequest(r *http.Request) (string, bool) {
+	if cookie, err := r.Cookie(refreshTokenCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, false
+	}
+
+	var input refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return "", false
+	}
+	return input.RefreshToken, input.RefreshToken != ""
+}
+
+// writeLoginResult hands out a new session either by setting cookies for
+// browsers or, when the client asked for it, by returning the tokens in the
+// body.
+func writeLoginResult(w http.ResponseWriter, r *http.Request, message string, result *models.LoginResult, returnTokens bool) {
+	if returnTokens {
+		writeTokenResponse(w, message, result, result.Tokens)
+		return
+	}
+
+	if err := setAuthCookies(w, result.Tokens); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": message,
+		"uuid":    result.UserUUID,
+	})
+}
+
+func writeTokenResponse(w http.ResponseWriter, message string, result *models.LoginResult, tokens *models.TokenPair) {
+	body := map[string]interface{}{
+		"message":                  message,
+		"token_type":               "Bearer",
+		"access_token":             tokens.AccessToken,
+		"access_token_expires_at":  tokens.AccessTokenExpiresAt,
+		"refresh_token":            tokens.RefreshToken,
+		"refresh_token_expires_at": tokens.RefreshTokenExpiresAt,
+	}
+	if result != nil {
+		body["uuid"] = result.UserUUID
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(body)
+}
+
+// setAuthCookies also issues the CSRF cookie. It is readable by scripts so the
+// frontend can echo it back in the X-CSRF-Token header.
+func setAuthCookies(w http.ResponseWriter, tokens *models.TokenPair) error {
+	csrfToken, err := middlewares.NewCSRFToken()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		Expires:  tokens.AccessTokenExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    tokens.RefreshToken,
+		Path:     refreshTokenPath,
+		Expires:  tokens.RefreshTokenExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     middlewares.CSRFCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		Expires:  tokens.RefreshTokenExpiresAt,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func clearAuthCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    "",
+		Path:     refreshTokenPath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     middlewares.CSRFCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
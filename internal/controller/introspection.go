@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Gezubov/user_service/internal/middlewares"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/problem"
+	"github.com/Gezubov/user_service/internal/service"
+)
+
+var ErrTokenRequired = problem.New(http.StatusBadRequest, problem.CodeTokenRequired, "token is required")
+
+// introspectionResponse follows RFC 7662. An inactive token is reported with
+// "active" alone, without saying why.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	TokenID   string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+func (c *UserController) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		problem.Write(w, r, ErrInvalidRequestBody)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		problem.Write(w, r, ErrTokenRequired)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	info, err := c.userService.Introspect(r.Context(), token)
+	switch {
+	case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrTokenRevoked):
+		json.NewEncoder(w).Encode(introspectionResponse{Active: false})
+		return
+	case err != nil:
+		problem.Write(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(introspectionResponse{
+		Active:    true,
+		Subject:   info.Claims.UserUUID.String(),
+		Username:  info.User.Username,
+		Email:     info.User.Email,
+		Role:      info.Claims.Role,
+		Scope:     strings.Join(info.Claims.Permissions, " "),
+		TokenType: "access_token",
+		TokenID:   info.Claims.TokenID,
+		IssuedAt:  info.Claims.IssuedAt.Unix(),
+		ExpiresAt: info.Claims.ExpiresAt.Unix(),
+	})
+}
+
+func (c *UserController) Me(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, ErrUnauthorized)
+		return
+	}
+
+	user, err := c.userService.GetUserByID(r.Context(), claims.UserUUID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sub":         claims.UserUUID,
+		"role":        claims.Role,
+		"permissions": claims.Permissions,
+		"iat":         claims.IssuedAt.Unix(),
+		"exp":         claims.ExpiresAt.Unix(),
+		"profile":     models.NewOwnerUserResponse(user),
+	})
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Gezubov/user_service/internal/infrastructure/jwtkeys"
+)
+
+type KeySet interface {
+	JWKS() jwtkeys.JWKS
+}
+
+type JWKSController struct {
+	keys KeySet
+}
+
+func NewJWKSController(keys KeySet) *JWKSController {
+	return &JWKSController{keys: keys}
+}
+
+// GetJWKS publishes the public keys other services use to verify our tokens.
+func (c *JWKSController) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(c.keys.JWKS())
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Gezubov/user_service/internal/middlewares"
+	"github.com/Gezubov/user_service/internal/problem"
+)
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type mfaVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	ReturnTokens   bool   `json:"return_tokens"`
+}
+
+func (c *UserController) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, ErrUnauthorized)
+		return
+	}
+
+	enrollment, err := c.userService.EnrollMFA(r.Context(), claims.UserUUID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+func (c *UserController) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, ErrUnauthorized)
+		return
+	}
+
+	var input mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, ErrInvalidRequestBody)
+		return
+	}
+
+	codes, err := c.userService.ConfirmMFA(r.Context(), claims.UserUUID, input.Code)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func (c *UserController) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, ErrUnauthorized)
+		return
+	}
+
+	var input mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, ErrInvalidRequestBody)
+		return
+	}
+
+	if err := c.userService.DisableMFA(r.Context(), claims.UserUUID, input.Code); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *UserController) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var input mfaVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, ErrInvalidRequestBody)
+		return
+	}
+
+	result, err := c.userService.VerifyMFA(r.Context(), input.ChallengeToken, input.Code, middlewares.ClientIP(r))
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	writeLoginResult(w, r, "Login successful", result, input.ReturnTokens)
+}
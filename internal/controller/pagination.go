@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/problem"
+)
+
+var ErrInvalidFilter = problem.New(http.StatusBadRequest, problem.CodeInvalidFilter, "invalid filter")
+var ErrInvalidSort = problem.New(http.StatusBadRequest, problem.CodeInvalidSort, "invalid sort")
+var ErrInvalidCursor = problem.New(http.StatusBadRequest, problem.CodeInvalidCursor, "invalid cursor")
+var ErrInvalidLimit = problem.New(http.StatusBadRequest, problem.CodeInvalidLimit, "invalid limit")
+var ErrPrivateFilter = problem.New(http.StatusForbidden, problem.CodeForbidden, "filtering by role, status or email requires the users:read permission")
+
+type userPageResponse[T any] struct {
+	Data []T      `json:"data"`
+	Meta pageMeta `json:"meta"`
+}
+
+type pageMeta struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	TotalCount int    `json:"total_count"`
+}
+
+// newUserPageResponse shows every user of the page through view.
+func newUserPageResponse[T any](page *models.UserPage, view func(*models.User) T) userPageResponse[T] {
+	data := make([]T, len(page.Users))
+	for i := range page.Users {
+		data[i] = view(&page.Users[i])
+	}
+
+	return userPageResponse[T]{
+		Data: data,
+		Meta: pageMeta{
+			NextCursor: page.NextCursor,
+			TotalCount: page.TotalCount,
+		},
+	}
+}
+
+// parseUserFilter reads listing parameters from the query string:
+// role, status, q, username_prefix, email_prefix, created_after,
+// created_before (RFC 3339), sort, cursor and limit. Role, status, q and
+// email_prefix match fields the public profile hides, and total_count would
+// give them away, so they are refused unless private is set.
+func parseUserFilter(query url.Values, private bool) (models.UserFilter, error) {
+	filter := models.UserFilter{
+		Role:           query.Get("role"),
+		Status:         query.Get("status"),
+		Query:          query.Get("q"),
+		UsernamePrefix: query.Get("username_prefix"),
+		EmailPrefix:    query.Get("email_prefix"),
+		Sort:           query.Get("sort"),
+	}
+
+	if !private && (filter.Role != "" || filter.Status != "" || filter.Query != "" || filter.EmailPrefix != "") {
+		return filter, ErrPrivateFilter
+	}
+	if filter.Role != "" && !models.IsValidRole(filter.Role) {
+		return filter, ErrInvalidRole
+	}
+	if filter.Status != "" && filter.Status != models.UserStatusActive && filter.Status != models.UserStatusSuspended {
+		return filter, ErrInvalidFilter
+	}
+	if filter.Sort != "" && !models.IsValidUserSort(filter.Sort) {
+		return filter, ErrInvalidSort
+	}
+
+	for name, dst := range map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, ErrInvalidFilter
+		}
+		*dst = &t
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := models.DecodeUserCursor(cursor)
+		if err != nil {
+			return filter, ErrInvalidCursor
+		}
+		filter.After = after
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > models.MaxPageSize {
+			return filter, ErrInvalidLimit
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
@@ -3,35 +3,52 @@ package controller
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"net/http"
 
 	"github.com/Gezubov/user_service/internal/middlewares"
 	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/problem"
+	"github.com/Gezubov/user_service/internal/service"
+	"github.com/Gezubov/user_service/internal/validation"
 	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 )
 
-var ErrInvalidUserID = errors.New("invalid user ID")
-var ErrInvalidRequestBody = errors.New("invalid request body")
-var ErrUnauthorized = errors.New("unauthorized")
-var ErrForbidden = errors.New("forbidden")
-var ErrUserNotFound = errors.New("user not found")
-var ErrInvalidCredentials = errors.New("invalid credentials")
-var ErrEmailAlreadyInUse = errors.New("email already in use")
-var ErrMethodNotAllowed = errors.New("method not allowed")
-var ErrUserIDRequired = errors.New("user ID is required")
-var ErrPasswordRequired = errors.New("password is required")
+var ErrInvalidUserID = problem.New(http.StatusBadRequest, problem.CodeInvalidUserID, "invalid user ID")
+var ErrInvalidRequestBody = problem.New(http.StatusBadRequest, problem.CodeInvalidRequestBody, "invalid request body")
+var ErrUnauthorized = problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "unauthorized")
+var ErrForbidden = problem.New(http.StatusForbidden, problem.CodeForbidden, "forbidden")
+var ErrMethodNotAllowed = problem.New(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "method not allowed")
+var ErrUserIDRequired = problem.New(http.StatusBadRequest, problem.CodeInvalidUserID, "user ID is required")
 
 type UserService interface {
 	CreateUser(ctx context.Context, user *models.User, password string) error
 	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
 	UpdateUser(ctx context.Context, user *models.User) error
 	DeleteUser(ctx context.Context, id uuid.UUID) error
-	GetAllUsers(ctx context.Context) ([]models.User, error)
-	Authenticate(ctx context.Context, identifier, password string) (string, error)
+	ChangePassword(ctx context.Context, claims *models.AccessTokenClaims, currentPassword, newPassword, ip string) (*models.TokenPair, error)
+	Authenticate(ctx context.Context, identifier, password, ip string) (*models.LoginResult, error)
+	Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error)
+	Logout(ctx context.Context, claims *models.AccessTokenClaims, refreshToken string) error
+	LogoutAll(ctx context.Context, userUUID uuid.UUID) error
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	ListUsers(ctx context.Context, filter models.UserFilter) (*models.UserPage, error)
+	ChangeRole(ctx context.Context, id uuid.UUID, role string) error
+	SuspendUser(ctx context.Context, id uuid.UUID) error
+	UnsuspendUser(ctx context.Context, id uuid.UUID) error
+	ForcePasswordReset(ctx context.Context, id uuid.UUID) error
+	RevokeSessions(ctx context.Context, id uuid.UUID) error
+	UnlockUser(ctx context.Context, id uuid.UUID) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, userUUID uuid.UUID) error
+	EnrollMFA(ctx context.Context, userUUID uuid.UUID) (*service.MFAEnrollment, error)
+	ConfirmMFA(ctx context.Context, userUUID uuid.UUID, code string) ([]string, error)
+	DisableMFA(ctx context.Context, userUUID uuid.UUID, code string) error
+	VerifyMFA(ctx context.Context, challenge, code, ip string) (*models.LoginResult, error)
+	Introspect(ctx context.Context, token string) (*models.TokenIntrospection, error)
 }
 
 type UserController struct {
@@ -48,149 +65,190 @@ func NewUserController(ctx context.Context, userService UserService) *UserContro
 
 func (c *UserController) GetUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		problem.Write(w, r, ErrMethodNotAllowed)
 		return
 	}
 
 	idStr := chi.URLParam(r, "id")
 	if idStr == "" {
-		http.Error(w, ErrInvalidUserID.Error(), http.StatusBadRequest)
+		problem.Write(w, r, ErrInvalidUserID)
 		return
 	}
 
 	uuid, err := uuid.Parse(idStr)
 	if err != nil {
-		http.Error(w, ErrInvalidUserID.Error(), http.StatusBadRequest)
+		problem.Write(w, r, ErrInvalidUserID)
 		return
 	}
 
 	user, err := c.userService.GetUserByID(context.Background(), uuid)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		problem.Write(w, r, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(userView(r, user))
 }
 
 func (c *UserController) GetUsers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		problem.Write(w, r, ErrMethodNotAllowed)
 		return
 	}
 
-	users, err := c.userService.GetAllUsers(context.Background())
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	filter, err := parseUserFilter(r.URL.Query(), ok && claims.HasPermission(models.PermissionUsersRead))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(users)
+	page, err := c.userService.ListUsers(context.Background(), filter)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newUserPageResponse(page, func(user *models.User) interface{} {
+		return userView(r, user)
+	}))
 }
 
 func (c *UserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPatch {
-		http.Error(w, ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		problem.Write(w, r, ErrMethodNotAllowed)
 		return
 	}
 
 	idStr := chi.URLParam(r, "id")
 	if idStr == "" {
-		http.Error(w, ErrUserIDRequired.Error(), http.StatusBadRequest)
+		problem.Write(w, r, ErrUserIDRequired)
 		return
 	}
 
 	uuid, err := uuid.Parse(idStr)
 	if err != nil {
-		http.Error(w, ErrInvalidUserID.Error(), http.StatusBadRequest)
+		problem.Write(w, r, ErrInvalidUserID)
+		return
+	}
+
+	if err := authorizeUserAccess(r, uuid, models.PermissionUsersUpdate); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
 	currentUser, err := c.userService.GetUserByID(context.Background(), uuid)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		problem.Write(w, r, err)
 		return
 	}
 
 	var user models.UserRegister
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, ErrInvalidRequestBody.Error(), http.StatusBadRequest)
+		problem.Write(w, r, ErrInvalidRequestBody)
+		return
+	}
+	if err := validation.Update(&user); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
 	if user.Username != "" {
 		currentUser.Username = user.Username
 	}
-	if user.Email != "" {
-		existingUser, err := c.userService.GetByEmail(context.Background(), user.Email)
-		if err == nil && existingUser.UUID != currentUser.UUID {
-			http.Error(w, ErrEmailAlreadyInUse.Error(), http.StatusConflict)
-			return
-		}
-		currentUser.Email = user.Email
-	}
+	// An empty email tells the service to leave the address alone.
+	currentUser.Email = user.Email
 
 	if err := c.userService.UpdateUser(context.Background(), currentUser); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(currentUser)
+	json.NewEncoder(w).Encode(userView(r, currentUser))
 }
 
 func (c *UserController) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
-		return
-	}
-
-	userID, ok := r.Context().Value(middlewares.UserIDKey).(string)
-	if !ok || userID == "" {
-		http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+		problem.Write(w, r, ErrMethodNotAllowed)
 		return
 	}
 
 	idStr := chi.URLParam(r, "id")
 	if idStr == "" {
-		http.Error(w, ErrUserIDRequired.Error(), http.StatusBadRequest)
+		problem.Write(w, r, ErrUserIDRequired)
 		return
 	}
 
-	if userID != idStr {
-		http.Error(w, ErrForbidden.Error(), http.StatusForbidden)
+	uuid, err := uuid.Parse(idStr)
+	if err != nil {
+		problem.Write(w, r, ErrInvalidUserID)
 		return
 	}
 
-	uuid, err := uuid.Parse(idStr)
-	if err != nil {
-		http.Error(w, ErrInvalidUserID.Error(), http.StatusBadRequest)
+	if err := authorizeUserAccess(r, uuid, models.PermissionUsersDelete); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
 	if err := c.userService.DeleteUser(context.Background(), uuid); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ChangePassword is for the account owner only, since it needs the current
+// password. The caller gets a new session; all others are ended.
+func (c *UserController) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, ErrInvalidUserID)
+		return
+	}
+
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, ErrUnauthorized)
+		return
+	}
+	if claims.UserUUID != id {
+		problem.Write(w, r, ErrForbidden)
+		return
+	}
+
+	var input models.PasswordChange
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, ErrInvalidRequestBody)
+		return
+	}
+
+	tokens, err := c.userService.ChangePassword(r.Context(), claims, input.CurrentPassword, input.NewPassword, middlewares.ClientIP(r))
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	result := &models.LoginResult{UserUUID: id, Tokens: tokens}
+	writeLoginResult(w, r, "Password changed", result, input.ReturnTokens)
+}
+
 func (c *UserController) Register(w http.ResponseWriter, r *http.Request) {
 	var input models.UserRegister
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, ErrInvalidRequestBody.Error(), http.StatusBadRequest)
+		problem.Write(w, r, ErrInvalidRequestBody)
 		return
 	}
-	if input.Password == "" {
-		http.Error(w, ErrPasswordRequired.Error(), http.StatusBadRequest)
+	if err := validation.Registration(&input); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 	user := models.User{Username: input.Username, Email: input.Email}
 
 	if err := c.userService.CreateUser(context.Background(), &user, input.Password); err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+		problem.Write(w, r, err)
 		return
 	}
 
@@ -204,46 +262,54 @@ func (c *UserController) Register(w http.ResponseWriter, r *http.Request) {
 func (c *UserController) Login(w http.ResponseWriter, r *http.Request) {
 	var input models.UserLogin
 
-	var err error
-
-	if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, ErrInvalidRequestBody.Error(), http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, ErrInvalidRequestBody)
 		return
 	}
 
-	token, err := c.userService.Authenticate(context.Background(), input.Identifier, input.Password)
+	result, err := c.userService.Authenticate(context.Background(), input.Identifier, input.Password, middlewares.ClientIP(r))
 	if err != nil {
-		http.Error(w, ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+		problem.Write(w, r, err)
 		return
 	}
 
-	var user *models.User
-	user, err = c.userService.GetByEmail(context.Background(), input.Identifier)
-	if err != nil {
-		user, err = c.userService.GetByUsername(context.Background(), input.Identifier)
-	}
-
-	if err != nil {
-		http.Error(w, ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+	if result.MFAChallenge != "" {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":         "Two-factor authentication required",
+			"mfa_required":    true,
+			"challenge_token": result.MFAChallenge,
+		})
 		return
 	}
 
-	if user == nil {
-		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
-		return
-	}
+	writeLoginResult(w, r, "Login successful", result, input.ReturnTokens)
+}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-	})
+// userView shows user to the caller: admins get the admin view, the owner
+// the owner view and everyone else, anonymous callers included, the public
+// profile.
+func userView(r *http.Request, user *models.User) interface{} {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	switch {
+	case ok && claims.HasPermission(models.PermissionUsersRead):
+		return models.NewAdminUserResponse(user)
+	case ok && claims.UserUUID == user.UUID:
+		return models.NewOwnerUserResponse(user)
+	default:
+		return models.NewPublicUserResponse(user)
+	}
+}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Login successful",
-		"uuid":    user.UUID,
-	})
+// authorizeUserAccess lets the owner of the target account through, as well as
+// any caller holding the given permission.
+func authorizeUserAccess(r *http.Request, target uuid.UUID, permission string) error {
+	claims, ok := middlewares.ClaimsFromContext(r.Context())
+	if !ok {
+		return ErrUnauthorized
+	}
+	if claims.UserUUID == target || claims.HasPermission(permission) {
+		return nil
+	}
+	return ErrForbidden
 }
@@ -0,0 +1,285 @@
+package controller_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/controller"
+	"github.com/Gezubov/user_service/internal/middlewares"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/service"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+)
+
+const (
+	secretHash = "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$c2VjcmV0LWhhc2g"
+	secretTOTP = "JBSWY3DPEHPK3PXP"
+)
+
+// secretFields must never appear as a key anywhere in a response body.
+var secretFields = []string{"password", "password_hash", "totp_secret", "totp_last_step"}
+
+// fakeUserService serves a single user with every secret field set. Methods
+// the tests do not call are left to the nil embedded interface.
+type fakeUserService struct {
+	controller.UserService
+	user   *models.User
+	filter models.UserFilter
+}
+
+func newFakeUserService() *fakeUserService {
+	now := time.Now()
+	return &fakeUserService{user: &models.User{
+		UUID:              uuid.New(),
+		Username:          "alice",
+		Email:             "alice@example.com",
+		PasswordHash:      secretHash,
+		Role:              models.RoleUser,
+		EmailVerifiedAt:   &now,
+		TOTPSecret:        secretTOTP,
+		TOTPEnabledAt:     &now,
+		TOTPLastStep:      123456,
+		PasswordChangedAt: &now,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}}
+}
+
+func (s *fakeUserService) CreateUser(ctx context.Context, user *models.User, password string) error {
+	user.UUID = uuid.New()
+	user.PasswordHash = secretHash
+	return nil
+}
+
+func (s *fakeUserService) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user := *s.user
+	return &user, nil
+}
+
+func (s *fakeUserService) UpdateUser(ctx context.Context, user *models.User) error {
+	return nil
+}
+
+func (s *fakeUserService) ListUsers(ctx context.Context, filter models.UserFilter) (*models.UserPage, error) {
+	s.filter = filter
+	return &models.UserPage{Users: []models.User{*s.user}, TotalCount: 1}, nil
+}
+
+// fakeValidator accepts the tokens it maps to claims and nothing else.
+type fakeValidator map[string]*models.AccessTokenClaims
+
+func (v fakeValidator) ValidateAccessToken(ctx context.Context, token string) (*models.AccessTokenClaims, error) {
+	claims, ok := v[token]
+	if !ok {
+		return nil, service.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// newRouter mounts the handlers behind the same authentication middlewares
+// as SetupRoutes, accepting bearer tokens known to validator.
+func newRouter(svc *fakeUserService, validator fakeValidator) http.Handler {
+	c := controller.NewUserController(context.Background(), svc)
+	sources := []string{middlewares.TokenSourceHeader}
+	auth := middlewares.AuthMiddleware(validator, sources)
+	optionalAuth := middlewares.OptionalAuthMiddleware(validator, sources)
+
+	r := chi.NewRouter()
+	r.With(optionalAuth).Get("/user/{id}", c.GetUser)
+	r.With(auth).Patch("/user/{id}", c.UpdateUser)
+	r.With(optionalAuth).Get("/users", c.GetUsers)
+	r.With(auth).Get("/admin/users", c.AdminListUsers)
+	r.With(auth).Get("/auth/me", c.Me)
+	r.Post("/auth/register", c.Register)
+	return r
+}
+
+// serve sends the request, bearing token unless it is empty, and checks that
+// the response carries no secret.
+func serve(t *testing.T, handler http.Handler, method, path, token, body string) map[string]interface{} {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code >= http.StatusBadRequest {
+		t.Fatalf("%s %s: status %d: %s", method, path, rec.Code, rec.Body)
+	}
+	for _, secret := range []string{secretHash, secretTOTP} {
+		if strings.Contains(rec.Body.String(), secret) {
+			t.Fatalf("%s %s: response contains a secret: %s", method, path, rec.Body)
+		}
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("%s %s: decoding response: %v", method, path, err)
+	}
+	for _, field := range secretFields {
+		if hasKey(decoded, field) {
+			t.Fatalf("%s %s: response has field %q: %s", method, path, field, rec.Body)
+		}
+	}
+	return decoded
+}
+
+// hasKey looks for key in every object nested in v.
+func hasKey(v interface{}, key string) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if k == key || hasKey(value, key) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if hasKey(value, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newValidator knows an "owner" token for the fake user and an "admin" token.
+func newValidator(svc *fakeUserService) fakeValidator {
+	return fakeValidator{
+		"owner": {UserUUID: svc.user.UUID, Role: models.RoleUser},
+		"admin": {
+			UserUUID:    uuid.New(),
+			Role:        models.RoleAdmin,
+			Permissions: models.PermissionsForRole(models.RoleAdmin),
+		},
+	}
+}
+
+func TestResponsesHaveNoSecretFields(t *testing.T) {
+	svc := newFakeUserService()
+	router := newRouter(svc, newValidator(svc))
+	id := svc.user.UUID.String()
+	update := `{"username":"alicia"}`
+	register := `{"username":"bobby","email":"bob@example.com","password":"Correct-Horse-9-battery"}`
+
+	requests := []struct {
+		method, path, body string
+		needsToken         bool
+	}{
+		{http.MethodGet, "/user/" + id, "", false},
+		{http.MethodGet, "/users", "", false},
+		{http.MethodPost, "/auth/register", register, false},
+		{http.MethodPatch, "/user/" + id, update, true},
+		{http.MethodGet, "/auth/me", "", true},
+		{http.MethodGet, "/admin/users", "", true},
+	}
+
+	for _, token := range []string{"", "owner", "admin"} {
+		for _, req := range requests {
+			if req.needsToken && token == "" {
+				continue
+			}
+			t.Run(token+" "+req.method+" "+req.path, func(t *testing.T) {
+				serve(t, router, req.method, req.path, token, req.body)
+			})
+		}
+	}
+}
+
+func TestUserViews(t *testing.T) {
+	svc := newFakeUserService()
+	router := newRouter(svc, newValidator(svc))
+	path := "/user/" + svc.user.UUID.String()
+
+	public := serve(t, router, http.MethodGet, path, "", "")
+	for _, field := range []string{"email", "role", "pending_email", "mfa_enabled"} {
+		if _, ok := public[field]; ok {
+			t.Errorf("public profile has field %q", field)
+		}
+	}
+	if public["username"] != "alice" {
+		t.Errorf("public profile has username %v, want alice", public["username"])
+	}
+
+	owner := serve(t, router, http.MethodGet, path, "owner", "")
+	if owner["email"] != "alice@example.com" || owner["mfa_enabled"] != true {
+		t.Errorf("owner view is missing account details: %v", owner)
+	}
+	if _, ok := owner["password_reset_required"]; ok {
+		t.Error("owner view has admin field password_reset_required")
+	}
+
+	admin := serve(t, router, http.MethodGet, path, "admin", "")
+	if _, ok := admin["password_reset_required"]; !ok {
+		t.Errorf("admin view is missing password_reset_required: %v", admin)
+	}
+}
+
+// status sends a GET request bearing token unless it is empty and returns
+// the response status.
+func status(handler http.Handler, path, token string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestGetUserRejectsInvalidToken(t *testing.T) {
+	svc := newFakeUserService()
+	router := newRouter(svc, newValidator(svc))
+
+	if code := status(router, "/user/"+svc.user.UUID.String(), "forged"); code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestListingPrivateFilters(t *testing.T) {
+	svc := newFakeUserService()
+	router := newRouter(svc, newValidator(svc))
+
+	for _, query := range []string{"role=admin", "status=suspended", "q=example", "email_prefix=alice"} {
+		for _, token := range []string{"", "owner"} {
+			if code := status(router, "/users?"+query, token); code != http.StatusForbidden {
+				t.Errorf("%q caller GET /users?%s: status %d, want %d", token, query, code, http.StatusForbidden)
+			}
+		}
+	}
+
+	serve(t, router, http.MethodGet, "/users?username_prefix=al", "", "")
+	if want := (models.UserFilter{UsernamePrefix: "al"}); svc.filter != want {
+		t.Errorf("anonymous listing used filter %+v, want %+v", svc.filter, want)
+	}
+
+	serve(t, router, http.MethodGet, "/users?role=admin&email_prefix=alice", "admin", "")
+	if want := (models.UserFilter{Role: models.RoleAdmin, EmailPrefix: "alice"}); svc.filter != want {
+		t.Errorf("admin listing used filter %+v, want %+v", svc.filter, want)
+	}
+}
+
+func TestListingViews(t *testing.T) {
+	svc := newFakeUserService()
+	router := newRouter(svc, newValidator(svc))
+
+	for token, field := range map[string]string{"": "", "owner": "email", "admin": "password_reset_required"} {
+		page := serve(t, router, http.MethodGet, "/users", token, "")
+		user := page["data"].([]interface{})[0].(map[string]interface{})
+		if _, ok := user["email"]; token == "" && ok {
+			t.Errorf("anonymous listing shows email: %v", user)
+		}
+		if _, ok := user[field]; field != "" && !ok {
+			t.Errorf("%s listing is missing %q: %v", token, field, user)
+		}
+	}
+}
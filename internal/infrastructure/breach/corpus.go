@@ -0,0 +1,126 @@
+// Package breach checks passwords against a local copy of a breached-password
+// corpus in the format published by Have I Been Pwned, so that no password or
+// hash ever leaves the host.
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const prefixLength = 5
+
+// Corpus answers lookups k-anonymity style: the SHA-1 of the password is split
+// into a 5 character prefix, which selects a range, and the suffix searched
+// for within it.
+//
+// Path may name a directory of range files as produced by the HIBP
+// downloader, one file per prefix ("0A1B2" or "0A1B2.txt") holding
+// "SUFFIX:COUNT" lines, which is read on demand. It may also name a single
+// file of "HASH:COUNT" lines, which is loaded into memory and suits smaller,
+// curated lists.
+type Corpus struct {
+	dir    string
+	ranges map[string]map[string]struct{}
+}
+
+func Open(path string) (*Corpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &Corpus{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	corpus := &Corpus{ranges: make(map[string]map[string]struct{})}
+	err = readRange(f, func(hash string) error {
+		if len(hash) != sha1.Size*2 {
+			return fmt.Errorf("breach: malformed hash %q in %s", hash, path)
+		}
+		prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+		if corpus.ranges[prefix] == nil {
+			corpus.ranges[prefix] = make(map[string]struct{})
+		}
+		corpus.ranges[prefix][suffix] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return corpus, nil
+}
+
+// IsBreached reports whether password appears in the corpus.
+func (c *Corpus) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	if c.ranges != nil {
+		_, found := c.ranges[prefix][suffix]
+		return found, nil
+	}
+
+	f, err := c.openRange(prefix)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	errFound := errors.New("found")
+	err = readRange(f, func(candidate string) error {
+		if candidate == suffix {
+			return errFound
+		}
+		return nil
+	})
+	if errors.Is(err, errFound) {
+		return true, nil
+	}
+	return false, err
+}
+
+func (c *Corpus) openRange(prefix string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(c.dir, prefix))
+	}
+	return f, err
+}
+
+// readRange calls fn with the upper-cased hash of every line. Entries with a
+// count of 0 are padding added by the HIBP API and are skipped.
+func readRange(r io.Reader, fn func(hash string) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		hash, count, _ := strings.Cut(line, ":")
+		if count == "0" {
+			continue
+		}
+		if err := fn(strings.ToUpper(hash)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
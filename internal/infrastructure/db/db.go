@@ -4,33 +4,107 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Gezubov/user_service/config"
-	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-var conn *pgx.Conn
+// Upper bound for the wait between two connection attempts.
+const maxConnectBackoff = 30 * time.Second
 
-func InitDB(ctx context.Context, dbConfig *config.DatabaseConfig) {
-	var err error
+var pool *pgxpool.Pool
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbConfig.Host, dbConfig.Port, dbConfig.Username, dbConfig.Password, dbConfig.Database)
+// InitDB opens the configured database: a SQLite file, or the Postgres
+// connection pool. Postgres may still be starting up (e.g. under docker
+// compose), so failed attempts are retried with exponential backoff; after
+// the last one the error is returned and the service should not start.
+func InitDB(ctx context.Context, dbConfig *config.DatabaseConfig) error {
+	switch dbConfig.Driver {
+	case "sqlite":
+		return initSQLite(ctx, dbConfig.SQLitePath)
+	case "", "postgres":
+	default:
+		return fmt.Errorf("unknown database driver %q", dbConfig.Driver)
+	}
 
-	conn, err = pgx.Connect(context.Background(), dsn)
+	poolConfig, err := pgxpool.ParseConfig(dsn(dbConfig))
 	if err != nil {
-		slog.Error("Unable to connect to database", "error", err)
-		return
+		return fmt.Errorf("invalid database configuration: %w", err)
+	}
+	poolConfig.MaxConns = dbConfig.MaxConns
+	poolConfig.MinConns = dbConfig.MinConns
+	poolConfig.MaxConnLifetime = time.Duration(dbConfig.MaxConnLifetime) * time.Second
+	poolConfig.MaxConnIdleTime = time.Duration(dbConfig.MaxConnIdleTime) * time.Second
+	if dbConfig.StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.Itoa(dbConfig.StatementTimeout)
+	}
+
+	attempts := dbConfig.ConnectAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := time.Duration(dbConfig.ConnectBackoff) * time.Second
+
+	for attempt := 1; ; attempt++ {
+		pool, err = connect(ctx, poolConfig)
+		if err == nil {
+			slog.Info("Connected to database", "max_conns", poolConfig.MaxConns)
+			return nil
+		}
+		if attempt == attempts {
+			return fmt.Errorf("unable to connect to database after %d attempts: %w", attempts, err)
+		}
+
+		slog.Warn("Unable to connect to database, retrying", "attempt", attempt, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
 	}
-	slog.Info("Connected to database")
 }
 
-func GetDB() *pgx.Conn {
-	return conn
+func connect(ctx context.Context, poolConfig *pgxpool.Config) (*pgxpool.Pool, error) {
+	p, err := pgxpool.ConnectConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Ping(ctx); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func dsn(dbConfig *config.DatabaseConfig) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		quote(dbConfig.Host), quote(dbConfig.Port), quote(dbConfig.Username),
+		quote(dbConfig.Password), quote(dbConfig.Database), quote(dbConfig.SSLMode))
+}
+
+// quote makes a value safe for a keyword/value connection string, where
+// spaces and quotes would otherwise break parsing.
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// GetDB returns the Postgres pool opened by InitDB. It is nil when the
+// driver is "sqlite".
+func GetDB() *pgxpool.Pool {
+	return pool
 }
 
 func CloseDB(ctx context.Context) {
-	if conn != nil {
-		conn.Close(ctx)
+	if pool != nil {
+		pool.Close()
+	}
+	if sqliteDB != nil {
+		sqliteDB.Close()
 	}
 }
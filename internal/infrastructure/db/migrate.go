@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/migrations"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/pressly/goose/v3"
+)
+
+// Migration commands accepted by Migrate.
+const (
+	MigrateUp     = "up"
+	MigrateDown   = "down"
+	MigrateStatus = "status"
+	MigrateRedo   = "redo"
+)
+
+// Migrate runs a goose command against the embedded migrations of the
+// configured driver. "down" and "redo" only touch the most recent migration.
+func Migrate(ctx context.Context, dbConfig *config.DatabaseConfig, command string) error {
+	if dbConfig.Driver == "sqlite" {
+		sqlDB, err := OpenSQLite(dbConfig.SQLitePath)
+		if err != nil {
+			return err
+		}
+		defer sqlDB.Close()
+
+		goose.SetBaseFS(migrations.SQLiteFS)
+		if err := goose.SetDialect("sqlite3"); err != nil {
+			return err
+		}
+		return runGoose(ctx, sqlDB, "sqlite", command)
+	}
+
+	connConfig, err := pgx.ParseConfig(dsn(dbConfig))
+	if err != nil {
+		return fmt.Errorf("invalid database configuration: %w", err)
+	}
+
+	sqlDB := stdlib.OpenDB(*connConfig)
+	defer sqlDB.Close()
+
+	goose.SetBaseFS(migrations.FS)
+	if err := goose.SetDialect("postgres"); err != nil {
+		return err
+	}
+
+	return runGoose(ctx, sqlDB, ".", command)
+}
+
+// runGoose applies command to the migrations in dir of the base FS.
+func runGoose(ctx context.Context, sqlDB *sql.DB, dir, command string) error {
+	switch command {
+	case MigrateUp:
+		return goose.UpContext(ctx, sqlDB, dir)
+	case MigrateDown:
+		return goose.DownContext(ctx, sqlDB, dir)
+	case MigrateStatus:
+		return goose.StatusContext(ctx, sqlDB, dir)
+	case MigrateRedo:
+		return goose.RedoContext(ctx, sqlDB, dir)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, status or redo", command)
+	}
+}
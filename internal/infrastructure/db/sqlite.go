@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	_ "modernc.org/sqlite"
+)
+
+var sqliteDB *sql.DB
+
+// initSQLite opens the SQLite database. SQLite allows one writer at a time,
+// so the service uses a single connection: concurrent transactions then wait
+// for each other instead of failing with SQLITE_BUSY.
+func initSQLite(ctx context.Context, path string) error {
+	db, err := OpenSQLite(path)
+	if err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return fmt.Errorf("unable to open SQLite database %q: %w", path, err)
+	}
+
+	sqliteDB = db
+	slog.Info("Opened SQLite database", "path", path)
+	return nil
+}
+
+// OpenSQLite opens the database file at path, creating it if needed, with
+// foreign keys enforced as the schema expects.
+func OpenSQLite(path string) (*sql.DB, error) {
+	dsn := path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	return sql.Open("sqlite", dsn)
+}
+
+// GetSQLite returns the database opened by InitDB when the driver is
+// "sqlite".
+func GetSQLite() *sql.DB {
+	return sqliteDB
+}
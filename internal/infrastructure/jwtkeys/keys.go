@@ -0,0 +1,223 @@
+// Package jwtkeys holds the keys used to sign and verify JWTs. Tokens are
+// signed with one active key and verified with any configured key, picked
+// by the "kid" header, so keys can be rotated without logging users out.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoSigningKey      = errors.New("no JWT signing key configured")
+	ErrUnknownKey        = errors.New("unknown JWT key")
+	ErrAlgorithmMismatch = errors.New("JWT algorithm does not match key")
+)
+
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// signer is nil for keys that are only kept to verify older tokens.
+	signer    crypto.Signer
+	publicKey crypto.PublicKey
+}
+
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+	// secret verifies legacy HS256 tokens that carry no kid.
+	secret []byte
+}
+
+// Load reads the PEM files listed in the configuration. Without any key
+// files, tokens are signed with the shared HS256 secret as before.
+func Load(cfg *config.JWTConfig) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*Key)}
+	if cfg.Secret != "" {
+		set.secret = []byte(cfg.Secret)
+	}
+
+	for id, path := range cfg.SigningKeys {
+		key, err := loadPrivateKey(id, path)
+		if err != nil {
+			return nil, err
+		}
+		set.keys[id] = key
+	}
+	for id, path := range cfg.VerificationKeys {
+		if _, ok := set.keys[id]; ok {
+			return nil, fmt.Errorf("JWT key %q configured twice", id)
+		}
+		key, err := loadPublicKey(id, path)
+		if err != nil {
+			return nil, err
+		}
+		set.keys[id] = key
+	}
+
+	if len(cfg.SigningKeys) == 0 {
+		if set.secret == nil {
+			return nil, ErrNoSigningKey
+		}
+		return set, nil
+	}
+
+	activeID := cfg.ActiveKeyID
+	if activeID == "" && len(cfg.SigningKeys) == 1 {
+		for id := range cfg.SigningKeys {
+			activeID = id
+		}
+	}
+	active, ok := set.keys[activeID]
+	if !ok || active.signer == nil {
+		return nil, fmt.Errorf("active JWT key %q is not a configured signing key", activeID)
+	}
+	set.active = active
+
+	return set, nil
+}
+
+// Sign signs the claims with the active key and sets the kid header.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if s.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	}
+
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.signer)
+}
+
+// Parse verifies the token signature and standard claims and fills claims.
+func (s *KeySet) Parse(tokenStr string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, s.keyFunc, jwt.WithValidMethods(s.validMethods()))
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return jwt.ErrTokenSignatureInvalid
+	}
+	return nil
+}
+
+func (s *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if s.secret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrUnknownKey
+		}
+		return s.secret, nil
+	}
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrAlgorithmMismatch
+	}
+	return key.publicKey, nil
+}
+
+func (s *KeySet) validMethods() []string {
+	var methods []string
+	if s.secret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	for _, key := range s.keys {
+		if !slices.Contains(methods, key.Method.Alg()) {
+			methods = append(methods, key.Method.Alg())
+		}
+	}
+	return methods
+}
+
+// Keys returns the asymmetric keys sorted by ID.
+func (s *KeySet) Keys() []*Key {
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+func loadPrivateKey(id, path string) (*Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("JWT key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("JWT key %q: %w", id, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("JWT key %q: RSA keys must be at least 2048 bits", id)
+		}
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, signer: key, publicKey: &key.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, signer: key, publicKey: key.Public()}, nil
+	default:
+		return nil, fmt.Errorf("JWT key %q: only RSA and Ed25519 keys are supported", id)
+	}
+}
+
+func loadPublicKey(id, path string) (*Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("JWT key %q: unsupported PEM block %q", id, block.Type)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("JWT key %q: %w", id, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, publicKey: key}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, publicKey: key}, nil
+	default:
+		return nil, fmt.Errorf("JWT key %q: only RSA and Ed25519 keys are supported", id)
+	}
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
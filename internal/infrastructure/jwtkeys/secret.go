@@ -0,0 +1,74 @@
+package jwtkeys
+
+import (
+	"crypto/rand"
+	"errors"
+	"log/slog"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minSecretSize is the HS256 key size recommended by RFC 7518, section 3.2.
+const minSecretSize = 32
+
+var (
+	ErrSecretTooShort        = errors.New("JWT secret must be at least 32 bytes")
+	ErrChallengeSecretReused = errors.New("JWT challenge secret must differ from the JWT secret")
+)
+
+// SecretKey signs and verifies HS256 tokens that never leave the service,
+// such as two-factor challenges. Unlike a KeySet it is never published, so
+// other services that trust the JWKS cannot be handed these tokens as access
+// tokens.
+type SecretKey struct {
+	secret []byte
+}
+
+// LoadSecretKey uses secret, or a random key when it is empty. A random key
+// is lost on restart and differs between instances, so tokens signed with it
+// only work on the instance that issued them.
+func LoadSecretKey(secret string) (*SecretKey, error) {
+	if secret != "" {
+		if len(secret) < minSecretSize {
+			return nil, ErrSecretTooShort
+		}
+		return &SecretKey{secret: []byte(secret)}, nil
+	}
+
+	key := make([]byte, minSecretSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	slog.Warn("No JWT challenge secret configured, using a random one; two-factor challenges only work on the instance that issued them")
+	return &SecretKey{secret: key}, nil
+}
+
+// LoadChallengeKey loads the key that signs two-factor challenges. It refuses
+// the secret of HS256 access tokens: sharing it would leave the typ claim as
+// the only thing telling challenges and access tokens apart.
+func LoadChallengeKey(cfg *config.JWTConfig) (*SecretKey, error) {
+	if cfg.ChallengeSecret != "" && cfg.ChallengeSecret == cfg.Secret {
+		return nil, ErrChallengeSecretReused
+	}
+	return LoadSecretKey(cfg.ChallengeSecret)
+}
+
+// Sign signs the claims with HS256.
+func (k *SecretKey) Sign(claims jwt.Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+}
+
+// Parse verifies an HS256 token signed with this key and fills claims.
+func (k *SecretKey) Parse(tokenStr string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(*jwt.Token) (interface{}, error) {
+		return k.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return jwt.ErrTokenSignatureInvalid
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package jwtkeys_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/infrastructure/jwtkeys"
+)
+
+func TestLoadChallengeKey(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name string
+		cfg  config.JWTConfig
+		err  error
+	}{
+		{"random", config.JWTConfig{Secret: secret}, nil},
+		{"own secret", config.JWTConfig{Secret: secret, ChallengeSecret: "fedcba9876543210fedcba9876543210"}, nil},
+		{"reused secret", config.JWTConfig{Secret: secret, ChallengeSecret: secret}, jwtkeys.ErrChallengeSecretReused},
+		{"short secret", config.JWTConfig{ChallengeSecret: "short"}, jwtkeys.ErrSecretTooShort},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := jwtkeys.LoadChallengeKey(&tc.cfg); !errors.Is(err, tc.err) {
+				t.Errorf("LoadChallengeKey = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+)
+
+// LogMailer does not deliver anything. It appends every message as a JSON
+// line to a file, or logs it when no file is configured, which is handy for
+// local development and tests.
+type LogMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+type loggedMessage struct {
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+func NewLogMailer(path string) *LogMailer {
+	return &LogMailer{path: path}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg models.MailMessage) error {
+	if m.path == "" {
+		slog.Info("Mail sent", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+		return nil
+	}
+
+	line, err := json.Marshal(loggedMessage{
+		To:      msg.To,
+		Subject: msg.Subject,
+		Body:    msg.Body,
+		SentAt:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
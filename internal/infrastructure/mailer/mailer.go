@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/models"
+)
+
+const (
+	DriverSMTP = "smtp"
+	DriverLog  = "log"
+)
+
+type Mailer interface {
+	Send(ctx context.Context, msg models.MailMessage) error
+}
+
+func New(cfg *config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case DriverSMTP:
+		return NewSMTPMailer(cfg), nil
+	case DriverLog, "":
+		return NewLogMailer(cfg.LogPath), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
@@ -3,41 +3,103 @@ package middlewares
 import (
 	"context"
 	"net/http"
+	"strings"
 
-	"github.com/Gezubov/user_service/config"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/problem"
 )
 
 type key string
 
-const UserIDKey key = "user_id"
+const (
+	UserIDKey key = "user_id"
+	ClaimsKey key = "claims"
+)
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("token")
-		if err != nil {
-			http.Error(w, "Missing token", http.StatusUnauthorized)
-			return
-		}
+const AccessTokenCookie = "token"
 
-		tokenStr := cookie.Value
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.GetConfig().JWT.Secret), nil
-		})
+var (
+	errMissingToken     = problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "missing token")
+	errInvalidCSRFToken = problem.New(http.StatusForbidden, problem.CodeInvalidCSRFToken, "invalid CSRF token")
+)
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
+// Places AuthMiddleware looks for the access token, in configurable order.
+const (
+	TokenSourceHeader = "header"
+	TokenSourceCookie = "cookie"
+)
+
+// TokenValidator verifies an access token, revocation included.
+type TokenValidator interface {
+	ValidateAccessToken(ctx context.Context, token string) (*models.AccessTokenClaims, error)
+}
+
+// AuthMiddleware accepts an access token from an "Authorization: Bearer"
+// header or the token cookie, trying sources in the given order. Cookies are
+// sent by the browser automatically, so requests authenticated by cookie must
+// also pass the CSRF check.
+func AuthMiddleware(validator TokenValidator, sources []string) func(http.Handler) http.Handler {
+	return authenticate(validator, sources, true)
+}
 
-		userID, ok := claims["user_id"].(string)
-		if !ok || userID == "" {
-			http.Error(w, "Invalid token payload", http.StatusUnauthorized)
-			return
+// OptionalAuthMiddleware is AuthMiddleware for endpoints that also serve
+// anonymous callers: a request without a token goes through without claims,
+// but a token that is sent must pass the same checks.
+func OptionalAuthMiddleware(validator TokenValidator, sources []string) func(http.Handler) http.Handler {
+	return authenticate(validator, sources, false)
+}
+
+func authenticate(validator TokenValidator, sources []string, required bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, source := tokenFromRequest(r, sources)
+			if token == "" {
+				if required {
+					problem.Write(w, r, errMissingToken)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if source == TokenSourceCookie && !validCSRF(r) {
+				problem.Write(w, r, errInvalidCSRFToken)
+				return
+			}
+
+			claims, err := validator.ValidateAccessToken(r.Context(), token)
+			if err != nil {
+				problem.Write(w, r, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserUUID.String())
+			ctx = context.WithValue(ctx, ClaimsKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func tokenFromRequest(r *http.Request, sources []string) (string, string) {
+	for _, source := range sources {
+		switch source {
+		case TokenSourceHeader:
+			scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if ok && strings.EqualFold(scheme, "Bearer") && token != "" {
+				return strings.TrimSpace(token), source
+			}
+		case TokenSourceCookie:
+			if cookie, err := r.Cookie(AccessTokenCookie); err == nil && cookie.Value != "" {
+				return cookie.Value, source
+			}
 		}
+	}
+	return "", ""
+}
 
-		ctx := context.WithValue(r.Context(), UserIDKey, userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+// ClaimsFromContext returns the claims AuthMiddleware or OptionalAuthMiddleware
+// stored for the request.
+func ClaimsFromContext(ctx context.Context) (*models.AccessTokenClaims, bool) {
+	claims, ok := ctx.Value(ClaimsKey).(*models.AccessTokenClaims)
+	return claims, ok && claims != nil
 }
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/Gezubov/user_service/internal/problem"
+)
+
+var errRequestBodyTooLarge = problem.New(http.StatusRequestEntityTooLarge, problem.CodeRequestBodyTooLarge, "request body too large")
+
+// MaxBodySize caps request bodies at limit bytes. Bodies that announce a
+// larger Content-Length are refused outright; others are cut off at the
+// limit, which makes decoding them fail.
+func MaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				problem.Write(w, r, errRequestBodyTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the address of the peer that sent the request. Behind a
+// reverse proxy, RemoteAddr has to be rewritten first (see chi's RealIP
+// middleware), otherwise every request appears to come from the proxy.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
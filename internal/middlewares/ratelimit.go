@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/problem"
+)
+
+// RateLimitStore keeps one token bucket per key. Take refills the bucket for
+// the time elapsed since the last call, then removes one token if there is
+// one. It returns the tokens left and whether the request may proceed.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit int, period time.Duration) (float64, bool, error)
+}
+
+// RateLimitKeyFunc picks the bucket a request is charged to.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitPolicy allows bursts of up to Limit requests, refilled evenly over
+// Period. Name keeps the buckets of different policies apart.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Key    RateLimitKeyFunc
+}
+
+// RateLimitByIP charges the client IP.
+func RateLimitByIP(r *http.Request) string {
+	return "ip:" + ClientIP(r)
+}
+
+// RateLimitByUser charges the authenticated user, falling back to the client
+// IP for anonymous requests. It must run after AuthMiddleware to see the user.
+func RateLimitByUser(r *http.Request) string {
+	if claims, ok := ClaimsFromContext(r.Context()); ok {
+		return "user:" + claims.UserUUID.String()
+	}
+	return RateLimitByIP(r)
+}
+
+// RateLimitByClient charges the service client or API key, falling back to
+// the client IP. It must run after ClientAuthMiddleware, so that only
+// verified credentials get a bucket of their own.
+func RateLimitByClient(r *http.Request) string {
+	if clientID, ok := r.Context().Value(ClientIDKey).(string); ok && clientID != "" {
+		return "client:" + clientID
+	}
+	return RateLimitByIP(r)
+}
+
+// RateLimit rejects requests over the policy with 429 and reports the state
+// of the bucket in RateLimit-* headers. If the store fails the request is let
+// through: a broken limiter should not take the API down with it.
+func RateLimit(store RateLimitStore, policy RateLimitPolicy) func(http.Handler) http.Handler {
+	keyFunc := policy.Key
+	if keyFunc == nil {
+		keyFunc = RateLimitByIP
+	}
+	perToken := policy.Period / time.Duration(policy.Limit)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := policy.Name + ":" + keyFunc(r)
+			tokens, allowed, err := store.Take(r.Context(), key, policy.Limit, policy.Period)
+			if err != nil {
+				slog.Error("Rate limiter unavailable", "policy", policy.Name, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Time until the bucket is full again.
+			reset := time.Duration((float64(policy.Limit) - tokens) * float64(perToken))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(math.Floor(tokens))))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+			w.Header().Set("RateLimit-Policy", strconv.Itoa(policy.Limit)+";w="+strconv.Itoa(ceilSeconds(policy.Period)))
+
+			if !allowed {
+				p := problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, "too many requests")
+				p.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+				problem.Write(w, r, p)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// refillBucket applies the token-bucket rule shared by the stores.
+func refillBucket(tokens float64, elapsed time.Duration, limit int, period time.Duration) (float64, bool) {
+	if elapsed > 0 {
+		tokens += elapsed.Seconds() * float64(limit) / period.Seconds()
+	}
+	tokens = math.Min(tokens, float64(limit))
+	if tokens < 1 {
+		return tokens, false
+	}
+	return tokens - 1, true
+}
@@ -0,0 +1,63 @@
+package middlewares
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryRateLimitStore keeps buckets in process. Each instance counts on its
+// own, so use the Postgres store when running more than one.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will have refilled completely, after which it
+	// is indistinguishable from a new one and can be dropped.
+	full time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit int, period time.Duration) (float64, bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(limit), updated: now}
+		s.buckets[key] = bucket
+	}
+
+	tokens, allowed := refillBucket(bucket.tokens, now.Sub(bucket.updated), limit, period)
+	bucket.tokens = tokens
+	bucket.updated = now
+	bucket.full = now.Add(time.Duration((float64(limit) - tokens) / float64(limit) * float64(period)))
+
+	return tokens, allowed, nil
+}
+
+// sweep drops full buckets at most once a minute so idle keys do not pile up.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, bucket := range s.buckets {
+		if now.After(bucket.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/problem"
+)
+
+var errForbidden = problem.New(http.StatusForbidden, problem.CodeForbidden, "forbidden")
+
+// RequireRole lets the request through when the caller has any of the given
+// roles. It must run after AuthMiddleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return requireClaims(func(claims *models.AccessTokenClaims) bool {
+		return claims.HasRole(roles...)
+	})
+}
+
+// RequirePermission lets the request through when the caller has all of the
+// given permissions. It must run after AuthMiddleware.
+func RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return requireClaims(func(claims *models.AccessTokenClaims) bool {
+		for _, permission := range permissions {
+			if !claims.HasPermission(permission) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func requireClaims(allowed func(claims *models.AccessTokenClaims) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				problem.Write(w, r, errMissingToken)
+				return
+			}
+
+			if !allowed(claims) {
+				problem.Write(w, r, errForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
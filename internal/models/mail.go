@@ -0,0 +1,7 @@
+package models
+
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
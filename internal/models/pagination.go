@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// Sort orders for user listings. A leading "-" means descending.
+const (
+	SortCreatedAtAsc  = "created_at"
+	SortCreatedAtDesc = "-created_at"
+	SortUsernameAsc   = "username"
+	SortUsernameDesc  = "-username"
+)
+
+var (
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrInvalidUserSort = errors.New("invalid sort")
+)
+
+func IsValidUserSort(sort string) bool {
+	switch sort {
+	case SortCreatedAtAsc, SortCreatedAtDesc, SortUsernameAsc, SortUsernameDesc:
+		return true
+	}
+	return false
+}
+
+// UserCursor points at the last user of a page. Together with the sort order
+// it is the keyset the next page starts after; UUID breaks ties.
+type UserCursor struct {
+	Sort      string    `json:"s"`
+	CreatedAt time.Time `json:"c,omitempty"`
+	Username  string    `json:"n,omitempty"`
+	UUID      uuid.UUID `json:"u"`
+}
+
+func NewUserCursor(sort string, user *User) *UserCursor {
+	cursor := &UserCursor{Sort: sort, UUID: user.UUID}
+	switch sort {
+	case SortUsernameAsc, SortUsernameDesc:
+		cursor.Username = user.Username
+	default:
+		cursor.CreatedAt = user.CreatedAt
+	}
+	return cursor
+}
+
+func (c *UserCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeUserCursor(s string) (*UserCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor UserCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if !IsValidUserSort(cursor.Sort) || cursor.UUID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+type UserPage struct {
+	Users      []User
+	NextCursor string
+	TotalCount int
+}
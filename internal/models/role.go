@@ -0,0 +1,36 @@
+package models
+
+import "slices"
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Permissions grant access to other users' accounts. Acting on one's own
+// account needs no permission.
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersUpdate = "users:update"
+	PermissionUsersDelete = "users:delete"
+	PermissionUsersManage = "users:manage"
+)
+
+var rolePermissions = map[string][]string{
+	RoleUser: {},
+	RoleAdmin: {
+		PermissionUsersRead,
+		PermissionUsersUpdate,
+		PermissionUsersDelete,
+		PermissionUsersManage,
+	},
+}
+
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func PermissionsForRole(role string) []string {
+	return slices.Clone(rolePermissions[role])
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RefreshToken struct {
+	UUID       uuid.UUID
+	UserUUID   uuid.UUID
+	FamilyUUID uuid.UUID
+	TokenHash  string
+	ExpiresAt  time.Time
+	RotatedAt  *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+type TokenPair struct {
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+// LoginResult carries either a token pair or, when the account has two-factor
+// authentication enabled, a challenge to exchange for one.
+type LoginResult struct {
+	UserUUID     uuid.UUID
+	Tokens       *TokenPair
+	MFAChallenge string
+}
+
+// AccessTokenClaims is the verified content of an access token.
+type AccessTokenClaims struct {
+	TokenID     string
+	UserUUID    uuid.UUID
+	Role        string
+	Permissions []string
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+}
+
+func (c *AccessTokenClaims) HasRole(roles ...string) bool {
+	return slices.Contains(roles, c.Role)
+}
+
+func (c *AccessTokenClaims) HasPermission(permission string) bool {
+	return slices.Contains(c.Permissions, permission)
+}
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeMFARecovery       = "mfa_recovery"
+)
+
+// OneTimeToken is a single-use, expiring token sent to the user out of band,
+// e.g. in a password reset link. Only its hash is stored.
+type OneTimeToken struct {
+	TokenHash string
+	UserUUID  uuid.UUID
+	Purpose   string
+	// Email is the address an email verification token was sent to.
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type TokenIntrospection struct {
+	Claims *AccessTokenClaims
+	User   *User
+}
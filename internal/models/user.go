@@ -7,13 +7,50 @@ import (
 )
 
 type User struct {
-	UUID         uuid.UUID `json:"uuid"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"password_hash"`
-	Role         string    `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	UUID                  uuid.UUID  `json:"uuid"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	PasswordHash          string     `json:"-"`
+	Role                  string     `json:"role"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at,omitempty"`
+	PendingEmail          string     `json:"pending_email,omitempty"`
+	TOTPSecret            string     `json:"-"`
+	TOTPEnabledAt         *time.Time `json:"totp_enabled_at,omitempty"`
+	TOTPLastStep          int64      `json:"-"`
+	SuspendedAt           *time.Time `json:"suspended_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	PasswordChangedAt     *time.Time `json:"password_changed_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil
+}
+
+func (u *User) MFAEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+)
+
+// UserFilter narrows down user listings. Zero values mean "no filter".
+type UserFilter struct {
+	Role           string
+	Status         string
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	UsernamePrefix string
+	EmailPrefix    string
+	// Query matches a substring of the username or the email.
+	Query string
+
+	Sort  string
+	After *UserCursor
+	Limit int
 }
 
 type UserRegister struct {
@@ -25,11 +62,74 @@ type UserRegister struct {
 type UserLogin struct {
 	Identifier string `json:"identifier"`
 	Password   string `json:"password"`
+	// ReturnTokens asks for the tokens in the response body instead of
+	// cookies, for clients that are not browsers.
+	ReturnTokens bool `json:"return_tokens"`
 }
 
-type UserResponse struct {
-	ID       int64  `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Role     string `json:"role"`
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+	ReturnTokens    bool   `json:"return_tokens"`
+}
+
+// PublicUserResponse is the profile anyone may see. A User is never written
+// to clients as is: the response views pick what each audience may see, and
+// each includes the one before it.
+type PublicUserResponse struct {
+	UUID      uuid.UUID `json:"uuid"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OwnerUserResponse adds what the account owner may see of their account.
+type OwnerUserResponse struct {
+	PublicUserResponse
+	Email             string     `json:"email"`
+	EmailVerified     bool       `json:"email_verified"`
+	PendingEmail      string     `json:"pending_email,omitempty"`
+	Role              string     `json:"role"`
+	MFAEnabled        bool       `json:"mfa_enabled"`
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// AdminUserResponse adds the account state that only admins manage.
+type AdminUserResponse struct {
+	OwnerUserResponse
+	EmailVerifiedAt       *time.Time `json:"email_verified_at,omitempty"`
+	TOTPEnabledAt         *time.Time `json:"totp_enabled_at,omitempty"`
+	SuspendedAt           *time.Time `json:"suspended_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+}
+
+func NewPublicUserResponse(u *User) PublicUserResponse {
+	return PublicUserResponse{
+		UUID:      u.UUID,
+		Username:  u.Username,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+func NewOwnerUserResponse(u *User) OwnerUserResponse {
+	return OwnerUserResponse{
+		PublicUserResponse: NewPublicUserResponse(u),
+		Email:              u.Email,
+		EmailVerified:      u.EmailVerifiedAt != nil,
+		PendingEmail:       u.PendingEmail,
+		Role:               u.Role,
+		MFAEnabled:         u.MFAEnabled(),
+		PasswordChangedAt:  u.PasswordChangedAt,
+		UpdatedAt:          u.UpdatedAt,
+	}
+}
+
+func NewAdminUserResponse(u *User) AdminUserResponse {
+	return AdminUserResponse{
+		OwnerUserResponse:     NewOwnerUserResponse(u),
+		EmailVerifiedAt:       u.EmailVerifiedAt,
+		TOTPEnabledAt:         u.TOTPEnabledAt,
+		SuspendedAt:           u.SuspendedAt,
+		PasswordResetRequired: u.PasswordResetRequired,
+	}
 }
@@ -0,0 +1,38 @@
+package models
+
+import "strings"
+
+// FieldError describes why one input field was rejected. Code is stable and
+// meant for clients; Message is for humans.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every problem found in a request, so that clients
+// can show them all at once.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Add(field, code, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Err returns nil when nothing was added, so callers can write
+// "return v.Err()".
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fieldErr.Field + ": " + fieldErr.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
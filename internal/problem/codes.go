@@ -0,0 +1,112 @@
+package problem
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/service"
+	"github.com/Gezubov/user_service/internal/storage"
+)
+
+// Problem codes. They are part of the API: clients branch on them, so
+// existing codes must never change meaning.
+const (
+	CodeInternal         = "INTERNAL_ERROR"
+	CodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	CodeRateLimited      = "RATE_LIMITED"
+
+	CodeInvalidRequestBody  = "INVALID_REQUEST_BODY"
+	CodeRequestBodyTooLarge = "REQUEST_BODY_TOO_LARGE"
+	CodeValidationFailed    = "VALIDATION_FAILED"
+	CodeInvalidUserID       = "INVALID_USER_ID"
+	CodeInvalidFilter       = "INVALID_FILTER"
+	CodeInvalidSort         = "INVALID_SORT"
+	CodeInvalidCursor       = "INVALID_CURSOR"
+	CodeInvalidLimit        = "INVALID_LIMIT"
+	CodeInvalidRole         = "INVALID_ROLE"
+	CodeEmailRequired       = "EMAIL_REQUIRED"
+	CodeTokenRequired       = "TOKEN_REQUIRED"
+
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeForbidden          = "FORBIDDEN"
+	CodeInvalidToken       = "INVALID_TOKEN"
+	CodeTokenRevoked       = "TOKEN_REVOKED"
+	CodeInvalidCSRFToken   = "INVALID_CSRF_TOKEN"
+	CodeInvalidClient      = "INVALID_CLIENT"
+	CodeCannotModifySelf   = "CANNOT_MODIFY_SELF"
+	CodeInvalidCredentials = "INVALID_CREDENTIALS"
+	CodeAccountSuspended   = "ACCOUNT_SUSPENDED"
+	CodeLoginLocked        = "LOGIN_LOCKED"
+
+	CodePasswordResetRequired    = "PASSWORD_RESET_REQUIRED"
+	CodeCurrentPasswordIncorrect = "CURRENT_PASSWORD_INCORRECT"
+	CodeInvalidRefreshToken      = "INVALID_REFRESH_TOKEN"
+	CodeInvalidResetToken        = "INVALID_RESET_TOKEN"
+	CodeInvalidVerificationToken = "INVALID_VERIFICATION_TOKEN"
+	CodeEmailAlreadyVerified     = "EMAIL_ALREADY_VERIFIED"
+
+	CodeMFAAlreadyEnabled   = "MFA_ALREADY_ENABLED"
+	CodeMFANotEnabled       = "MFA_NOT_ENABLED"
+	CodeMFANotEnrolled      = "MFA_NOT_ENROLLED"
+	CodeInvalidMFACode      = "INVALID_MFA_CODE"
+	CodeInvalidMFAChallenge = "INVALID_MFA_CHALLENGE"
+
+	CodeUserNotFound  = "USER_NOT_FOUND"
+	CodeUsernameTaken = "USERNAME_TAKEN"
+	CodeEmailTaken    = "EMAIL_TAKEN"
+)
+
+type mapping struct {
+	err    error
+	status int
+	code   string
+	// detail replaces the message of err when set.
+	detail string
+	// retryAfter, if set, extracts how long the client should wait.
+	retryAfter func(err error) time.Duration
+}
+
+// mappings gives the domain errors of the storage and service layers their
+// HTTP status and code. The detail is the message of the listed error, not
+// of whatever wraps it, unless the mapping overrides it.
+var mappings = []mapping{
+	{err: storage.ErrUserNotFound, status: http.StatusNotFound, code: CodeUserNotFound},
+	{err: storage.ErrUsernameTaken, status: http.StatusConflict, code: CodeUsernameTaken},
+	{err: storage.ErrEmailTaken, status: http.StatusConflict, code: CodeEmailTaken},
+
+	{err: models.ErrInvalidCursor, status: http.StatusBadRequest, code: CodeInvalidCursor},
+	{err: models.ErrInvalidUserSort, status: http.StatusBadRequest, code: CodeInvalidSort},
+
+	{err: service.ErrInvalidCredentials, status: http.StatusUnauthorized, code: CodeInvalidCredentials},
+	{err: service.ErrAccountSuspended, status: http.StatusForbidden, code: CodeAccountSuspended},
+	{err: service.ErrPasswordResetRequired, status: http.StatusForbidden, code: CodePasswordResetRequired},
+	{err: service.ErrLoginLocked, status: http.StatusTooManyRequests, code: CodeLoginLocked, detail: "too many failed login attempts, try again later", retryAfter: loginRetryAfter},
+	{err: service.ErrCurrentPasswordIncorrect, status: http.StatusForbidden, code: CodeCurrentPasswordIncorrect},
+	{err: service.ErrInvalidRole, status: http.StatusBadRequest, code: CodeInvalidRole},
+
+	{err: service.ErrInvalidToken, status: http.StatusUnauthorized, code: CodeInvalidToken},
+	{err: service.ErrTokenRevoked, status: http.StatusUnauthorized, code: CodeTokenRevoked},
+	{err: service.ErrInvalidRefreshToken, status: http.StatusUnauthorized, code: CodeInvalidRefreshToken},
+	// Reuse is reported like any other bad token so as not to tell a thief
+	// that the theft was noticed.
+	{err: service.ErrRefreshTokenReused, status: http.StatusUnauthorized, code: CodeInvalidRefreshToken, detail: service.ErrInvalidRefreshToken.Error()},
+	{err: service.ErrInvalidResetToken, status: http.StatusBadRequest, code: CodeInvalidResetToken},
+	{err: service.ErrInvalidVerificationToken, status: http.StatusBadRequest, code: CodeInvalidVerificationToken},
+	{err: service.ErrEmailAlreadyVerified, status: http.StatusConflict, code: CodeEmailAlreadyVerified},
+
+	{err: service.ErrMFAAlreadyEnabled, status: http.StatusConflict, code: CodeMFAAlreadyEnabled},
+	{err: service.ErrMFANotEnabled, status: http.StatusConflict, code: CodeMFANotEnabled},
+	{err: service.ErrMFANotEnrolled, status: http.StatusConflict, code: CodeMFANotEnrolled},
+	{err: service.ErrInvalidMFACode, status: http.StatusUnauthorized, code: CodeInvalidMFACode},
+	{err: service.ErrInvalidMFAChallenge, status: http.StatusUnauthorized, code: CodeInvalidMFAChallenge},
+}
+
+func loginRetryAfter(err error) time.Duration {
+	var locked *service.LoginLockedError
+	if errors.As(err, &locked) {
+		return locked.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+// Package problem writes error responses as RFC 7807 problem details
+// (application/problem+json). Every problem carries a stable,
+// machine-readable code next to the human-readable detail, and this package
+// is the one place where domain errors are given an HTTP status.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object. It is also an error, so
+// handlers can declare their request errors as problems and return them like
+// any other error.
+type Problem struct {
+	// Type is always "about:blank": the code identifies the problem and the
+	// title is the HTTP status text, as RFC 7807 prescribes for that type.
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Code     string              `json:"code"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Errors   []models.FieldError `json:"errors,omitempty"`
+
+	// RetryAfter is sent as the Retry-After header when set.
+	RetryAfter time.Duration `json:"-"`
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+func (p *Problem) Error() string {
+	return p.Detail
+}
+
+// Is lets errors.Is match problems by code, so a copy returned by From still
+// matches the declared value.
+func (p *Problem) Is(target error) bool {
+	t, ok := target.(*Problem)
+	return ok && t.Code == p.Code
+}
+
+// From returns the problem describing err: err itself when it is a problem,
+// field errors for a *models.ValidationError, the mapped problem for known
+// domain errors and INTERNAL_ERROR for anything else. The result is a copy
+// that the caller may modify.
+func From(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		c := *p
+		return &c
+	}
+
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		p := New(http.StatusBadRequest, CodeValidationFailed, "validation failed")
+		p.Errors = validationErr.Errors
+		return p
+	}
+
+	for _, m := range mappings {
+		if errors.Is(err, m.err) {
+			detail := m.detail
+			if detail == "" {
+				detail = m.err.Error()
+			}
+			p := New(m.status, m.code, detail)
+			if m.retryAfter != nil {
+				p.RetryAfter = m.retryAfter(err)
+			}
+			return p
+		}
+	}
+
+	return New(http.StatusInternalServerError, CodeInternal, "internal error")
+}
+
+// Write answers the request with the problem describing err. The text of
+// unmapped errors is logged, never sent: it may come from the database
+// driver or another internal layer.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p := From(err)
+	if p.Status >= http.StatusInternalServerError {
+		slog.Error("Request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+	p.Instance = r.URL.Path
+
+	if p.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(p.RetryAfter.Seconds()))))
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
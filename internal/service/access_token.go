@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+func (s *UserService) generateJWT(user *models.User) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(time.Duration(config.GetConfig().JWT.Expiration) * time.Second)
+	claims := jwt.MapClaims{
+		"jti":         uuid.NewString(),
+		"typ":         tokenTypeAccess,
+		"user_id":     user.UUID,
+		"role":        user.Role,
+		"permissions": models.PermissionsForRole(user.Role),
+		"iat":         numericDate(now),
+		"exp":         expirationTime.Unix(),
+	}
+	signed, err := s.keys.Sign(claims)
+	return signed, expirationTime, err
+}
+
+// ValidateAccessToken checks the signature, expiry and revocation status of
+// an access token and returns its claims.
+func (s *UserService) ValidateAccessToken(ctx context.Context, token string) (*models.AccessTokenClaims, error) {
+	mapClaims := jwt.MapClaims{}
+	if err := s.keys.Parse(token, mapClaims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims, err := claimsFromMap(mapClaims, tokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// Introspect reports who an access token belongs to. A token that is valid
+// but whose user was deleted or suspended is not active.
+func (s *UserService) Introspect(ctx context.Context, token string) (*models.TokenIntrospection, error) {
+	claims, err := s.ValidateAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByUUID(ctx, claims.UserUUID)
+	if err != nil || user.IsSuspended() {
+		return nil, ErrInvalidToken
+	}
+
+	return &models.TokenIntrospection{Claims: claims, User: user}, nil
+}
+
+// numericDate returns t as a JWT NumericDate with microsecond precision.
+// Whole seconds would not tell apart a token issued right after a
+// logout-all from the ones it revoked (see RevocationList.IsRevoked).
+func numericDate(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
+
+// claimsFromMap checks that the token is of the expected type, so that one
+// kind of token can never stand in for another.
+func claimsFromMap(claims jwt.MapClaims, tokenType string) (*models.AccessTokenClaims, error) {
+	if typ, _ := claims["typ"].(string); typ != tokenType {
+		return nil, ErrInvalidToken
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, ErrInvalidToken
+	}
+
+	userID, _ := claims["user_id"].(string)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	issuedAt, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return nil, ErrInvalidToken
+	}
+
+	result := &models.AccessTokenClaims{
+		TokenID:   jti,
+		UserUUID:  userUUID,
+		IssuedAt:  time.UnixMicro(int64(math.Round(issuedAt * 1e6))),
+		ExpiresAt: expiresAt.Time,
+	}
+	if tokenType != tokenTypeAccess {
+		return result, nil
+	}
+
+	result.Role, _ = claims["role"].(string)
+	if result.Role == "" {
+		return nil, ErrInvalidToken
+	}
+	if raw, ok := claims["permissions"].([]interface{}); ok {
+		for _, p := range raw {
+			permission, ok := p.(string)
+			if !ok {
+				return nil, ErrInvalidToken
+			}
+			result.Permissions = append(result.Permissions, permission)
+		}
+	}
+
+	return result, nil
+}
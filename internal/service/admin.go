@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+// ChangeRole takes effect immediately: access tokens carrying the old role
+// are revoked, while refresh tokens stay valid and pick up the new role.
+func (s *UserService) ChangeRole(ctx context.Context, uuid uuid.UUID, role string) error {
+	if !models.IsValidRole(role) {
+		return ErrInvalidRole
+	}
+	if err := s.userRepo.UpdateRole(ctx, uuid, role); err != nil {
+		return err
+	}
+	return s.revocations.RevokeAllForUser(ctx, uuid)
+}
+
+func (s *UserService) SuspendUser(ctx context.Context, uuid uuid.UUID) error {
+	now := time.Now().UTC()
+	if err := s.userRepo.UpdateSuspension(ctx, uuid, &now); err != nil {
+		return err
+	}
+	return s.LogoutAll(ctx, uuid)
+}
+
+func (s *UserService) UnsuspendUser(ctx context.Context, uuid uuid.UUID) error {
+	return s.userRepo.UpdateSuspension(ctx, uuid, nil)
+}
+
+// ForcePasswordReset logs the user out everywhere, refuses further logins
+// until the password has been reset and mails them a reset link.
+func (s *UserService) ForcePasswordReset(ctx context.Context, uuid uuid.UUID) error {
+	user, err := s.userRepo.GetByUUID(ctx, uuid)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePasswordResetRequired(ctx, uuid, true); err != nil {
+		return err
+	}
+	if err := s.LogoutAll(ctx, uuid); err != nil {
+		return err
+	}
+	return s.sendPasswordResetLink(ctx, user)
+}
+
+func (s *UserService) RevokeSessions(ctx context.Context, uuid uuid.UUID) error {
+	if _, err := s.userRepo.GetByUUID(ctx, uuid); err != nil {
+		return err
+	}
+	return s.LogoutAll(ctx, uuid)
+}
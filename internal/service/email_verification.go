@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	ErrEmailAlreadyVerified     = errors.New("email already verified")
+)
+
+// VerifyEmail confirms the address a verification token was sent to. For an
+// email change, this is the moment the new address replaces the old one.
+//
+// If somebody else has taken the address in the meantime, the result is
+// storage.ErrEmailTaken and the token stays usable.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	return s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		stored, err := s.oneTimeTokenRepo.Consume(ctx, hashToken(token), models.TokenPurposeEmailVerification)
+		if err != nil {
+			return ErrInvalidVerificationToken
+		}
+
+		err = s.userRepo.MarkEmailVerified(ctx, stored.UserUUID, stored.Email)
+		if errors.Is(err, storage.ErrEmailTaken) {
+			return err
+		}
+		if err != nil {
+			return ErrInvalidVerificationToken
+		}
+		return nil
+	})
+}
+
+// ResendVerification sends a fresh link for the pending address, or for the
+// current one if it was never verified. Older links stop working.
+func (s *UserService) ResendVerification(ctx context.Context, userUUID uuid.UUID) error {
+	user, err := s.userRepo.GetByUUID(ctx, userUUID)
+	if err != nil {
+		return err
+	}
+
+	email := user.PendingEmail
+	if email == "" {
+		if user.EmailVerifiedAt != nil {
+			return ErrEmailAlreadyVerified
+		}
+		email = user.Email
+	}
+
+	msg, err := s.verificationMail(ctx, user, email)
+	if err != nil {
+		return err
+	}
+	s.sendMail(*msg)
+	return nil
+}
+
+// requestEmailChange keeps the current address until the new one is verified
+// and returns the verification mail for it. Pending addresses are not unique,
+// so the lookup below only spares the user a pointless verification mail;
+// MarkEmailVerified has the final word.
+func (s *UserService) requestEmailChange(ctx context.Context, user *models.User, email string) (*models.MailMessage, error) {
+	existing, err := s.userRepo.GetByEmail(ctx, email)
+	if err == nil && existing.UUID != user.UUID {
+		return nil, storage.ErrEmailTaken
+	}
+
+	if err := s.userRepo.UpdatePendingEmail(ctx, user.UUID, email); err != nil {
+		return nil, err
+	}
+	user.PendingEmail = email
+
+	return s.verificationMail(ctx, user, email)
+}
+
+// verificationMail replaces the user's verification links with a new one for
+// email and returns the message carrying it. Within a transaction, send it
+// only once the transaction has committed, or a rollback would leave the
+// recipient with a link to nothing.
+func (s *UserService) verificationMail(ctx context.Context, user *models.User, email string) (*models.MailMessage, error) {
+	if err := s.oneTimeTokenRepo.InvalidateForUser(ctx, user.UUID, models.TokenPurposeEmailVerification); err != nil {
+		return nil, err
+	}
+
+	expiration := time.Duration(config.GetConfig().Auth.EmailVerificationExpiration) * time.Second
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.oneTimeTokenRepo.Create(ctx, &models.OneTimeToken{
+		TokenHash: hashToken(token),
+		UserUUID:  user.UUID,
+		Purpose:   models.TokenPurposeEmailVerification,
+		Email:     email,
+		ExpiresAt: time.Now().Add(expiration),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	link := config.GetConfig().Server.FrontendURL + "/verify-email?token=" + url.QueryEscape(token)
+	return &models.MailMessage{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Please confirm that %s is your email address by following the link below:\n\n"+
+			"%s\n\n"+
+			"The link expires in %s.\n",
+			user.Username, email, link, expiration),
+	}, nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Gezubov/user_service/internal/models"
+)
+
+// ListUsers returns one page of users using keyset pagination: the next page
+// starts right after the cursor, so pages stay stable while users sign up.
+func (s *UserService) ListUsers(ctx context.Context, filter models.UserFilter) (*models.UserPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = models.SortCreatedAtAsc
+	}
+	if !models.IsValidUserSort(filter.Sort) {
+		return nil, models.ErrInvalidUserSort
+	}
+	if filter.After != nil && filter.After.Sort != filter.Sort {
+		return nil, models.ErrInvalidCursor
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = models.DefaultPageSize
+	}
+	limit = min(limit, models.MaxPageSize)
+
+	total, err := s.userRepo.Count(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to find out whether there is a next page.
+	filter.Limit = limit + 1
+	users, err := s.userRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.UserPage{Users: users, TotalCount: total}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor = models.NewUserCursor(filter.Sort, &page.Users[limit-1]).Encode()
+	}
+	return page, nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrLoginLocked = errors.New("too many failed login attempts")
+
+// LoginLockedError is returned while a lock is in force; it matches
+// ErrLoginLocked with errors.Is.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrLoginLocked.Error()
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrLoginLocked
+}
+
+const (
+	lockScopeAccount = "account"
+	lockScopeIP      = "ip"
+)
+
+type LoginFailureStorage interface {
+	// WithLock runs fn while holding a lock on the counters of scope and
+	// subject: calls for the same counters, from any instance sharing the
+	// storage, run one at a time.
+	WithLock(ctx context.Context, scope, subject string, fn func(ctx context.Context) error) error
+	RecordFailure(ctx context.Context, scope, subject string, window time.Duration) (int, error)
+	Lock(ctx context.Context, scope, subject string, until time.Time) error
+	GetLockedUntil(ctx context.Context, scope, subject string) (time.Time, error)
+	Reset(ctx context.Context, scope, subject string) error
+}
+
+// LockoutPolicy sets how many failures an account or a client IP may
+// accumulate within Window before being locked. The first lock lasts
+// BaseDuration and every further failure doubles it, up to MaxDuration.
+type LockoutPolicy struct {
+	AccountThreshold int
+	IPThreshold      int
+	Window           time.Duration
+	BaseDuration     time.Duration
+	MaxDuration      time.Duration
+}
+
+// LoginThrottle tracks failed logins per account and per client IP. State is
+// kept in storage so locks survive restarts and apply across instances.
+type LoginThrottle struct {
+	repo   LoginFailureStorage
+	policy LockoutPolicy
+}
+
+func NewLoginThrottle(repo LoginFailureStorage, policy LockoutPolicy) *LoginThrottle {
+	return &LoginThrottle{repo: repo, policy: policy}
+}
+
+// Attempt runs verify for a login attempt on the account from the IP and
+// returns its verdict. While either is locked it returns a *LoginLockedError
+// without calling verify; a false verdict counts as a failure for both.
+// Attempts on the same account or IP run one at a time, so that parallel
+// guesses cannot all pass the lock check before any failure is counted. An
+// empty account or IP is not tracked.
+func (t *LoginThrottle) Attempt(ctx context.Context, account uuid.UUID, ip string, verify func(ctx context.Context) (bool, error)) (bool, error) {
+	var ok bool
+	err := t.withLocks(ctx, t.targets(account, ip), func(ctx context.Context) error {
+		if err := t.check(ctx, account, ip); err != nil {
+			return err
+		}
+
+		var err error
+		if ok, err = verify(ctx); err != nil || ok {
+			return err
+		}
+		return t.recordFailure(ctx, account, ip)
+	})
+	return ok, err
+}
+
+// withLocks runs fn holding the locks of every target. They are taken in the
+// order targets lists them, account before IP, so attempts cannot deadlock.
+func (t *LoginThrottle) withLocks(ctx context.Context, targets []lockTarget, fn func(ctx context.Context) error) error {
+	if len(targets) == 0 {
+		return fn(ctx)
+	}
+	return t.repo.WithLock(ctx, targets[0].scope, targets[0].subject, func(ctx context.Context) error {
+		return t.withLocks(ctx, targets[1:], fn)
+	})
+}
+
+// check returns a *LoginLockedError when either the account or the IP is
+// locked.
+func (t *LoginThrottle) check(ctx context.Context, account uuid.UUID, ip string) error {
+	var retryAfter time.Duration
+	for _, target := range t.targets(account, ip) {
+		until, err := t.repo.GetLockedUntil(ctx, target.scope, target.subject)
+		if err != nil {
+			return err
+		}
+		if wait := time.Until(until); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+func (t *LoginThrottle) recordFailure(ctx context.Context, account uuid.UUID, ip string) error {
+	for _, target := range t.targets(account, ip) {
+		failures, err := t.repo.RecordFailure(ctx, target.scope, target.subject, t.policy.Window)
+		if err != nil {
+			return err
+		}
+		if failures < target.threshold {
+			continue
+		}
+		until := time.Now().Add(t.lockDuration(failures - target.threshold))
+		if err := t.repo.Lock(ctx, target.scope, target.subject, until); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unlock clears the failure count of an account. The client IP is left alone
+// so that logging into one account does not reset the budget for guessing
+// others.
+func (t *LoginThrottle) Unlock(ctx context.Context, account uuid.UUID) error {
+	return t.repo.Reset(ctx, lockScopeAccount, account.String())
+}
+
+type lockTarget struct {
+	scope     string
+	subject   string
+	threshold int
+}
+
+func (t *LoginThrottle) targets(account uuid.UUID, ip string) []lockTarget {
+	var targets []lockTarget
+	if account != uuid.Nil && t.policy.AccountThreshold > 0 {
+		targets = append(targets, lockTarget{lockScopeAccount, account.String(), t.policy.AccountThreshold})
+	}
+	if ip != "" && t.policy.IPThreshold > 0 {
+		targets = append(targets, lockTarget{lockScopeIP, ip, t.policy.IPThreshold})
+	}
+	return targets
+}
+
+func (t *LoginThrottle) lockDuration(excess int) time.Duration {
+	d := t.policy.BaseDuration
+	for i := 0; i < excess && d < t.policy.MaxDuration; i++ {
+		d *= 2
+	}
+	if d > t.policy.MaxDuration {
+		d = t.policy.MaxDuration
+	}
+	return d
+}
+
+// UnlockUser lifts a lockout caused by failed logins.
+func (s *UserService) UnlockUser(ctx context.Context, uuid uuid.UUID) error {
+	if _, err := s.userRepo.GetByUUID(ctx, uuid); err != nil {
+		return err
+	}
+	return s.throttle.Unlock(ctx, uuid)
+}
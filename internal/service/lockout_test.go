@@ -0,0 +1,71 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/service"
+)
+
+// slowFailures delays the answer to lock checks, as a database round-trip
+// would.
+type slowFailures struct {
+	service.LoginFailureStorage
+}
+
+func (s slowFailures) GetLockedUntil(ctx context.Context, scope, subject string) (time.Time, error) {
+	until, err := s.LoginFailureStorage.GetLockedUntil(ctx, scope, subject)
+	time.Sleep(time.Millisecond)
+	return until, err
+}
+
+func TestParallelWrongPasswordsHitTheLockout(t *testing.T) {
+	const threshold, attempts = 3, 20
+	env := newTestEnvWith(t, testOptions{
+		wrapFailures: func(failures service.LoginFailureStorage) service.LoginFailureStorage {
+			return slowFailures{failures}
+		},
+		lockout: service.LockoutPolicy{
+			AccountThreshold: threshold,
+			Window:           time.Hour,
+			BaseDuration:     time.Minute,
+			MaxDuration:      time.Hour,
+		},
+	})
+	user := env.register(t, "alice")
+
+	// Release every attempt at once so that they overlap.
+	start := make(chan struct{})
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := env.users.Authenticate(context.Background(), user.Username, "wrong password", testIP)
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	var rejected, locked int
+	for err := range errs {
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			rejected++
+		case errors.Is(err, service.ErrLoginLocked):
+			locked++
+		default:
+			t.Errorf("Authenticate = %v, want %v or %v", err, service.ErrInvalidCredentials, service.ErrLoginLocked)
+		}
+	}
+	if rejected != threshold || locked != attempts-threshold {
+		t.Errorf("%d passwords checked and %d attempts locked out, want %d and %d", rejected, locked, threshold, attempts-threshold)
+	}
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/pkg/totp"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication already enabled")
+	ErrMFANotEnabled       = errors.New("two-factor authentication not enabled")
+	ErrMFANotEnrolled      = errors.New("two-factor authentication enrollment not started")
+	ErrInvalidMFACode      = errors.New("invalid two-factor authentication code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired two-factor authentication challenge")
+)
+
+const (
+	tokenTypeAccess       = "access"
+	tokenTypeMFAChallenge = "mfa_challenge"
+
+	recoveryCodeCount = 10
+	// Recovery codes do not expire; they are only replaced or used up.
+	recoveryCodeLifetime = 100 * 365 * 24 * time.Hour
+	// Accept codes from one step before and after the current one to allow
+	// for clock drift between the server and the authenticator app.
+	totpSkew = 1
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// EnrollMFA starts two-factor enrollment by generating a new secret. It stays
+// inactive until ConfirmMFA proves the user's authenticator app has it.
+func (s *UserService) EnrollMFA(ctx context.Context, userUUID uuid.UUID) (*MFAEnrollment, error) {
+	user, err := s.userRepo.GetByUUID(ctx, userUUID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdateTOTP(ctx, user.UUID, secret, nil); err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    totp.URI(config.GetConfig().Auth.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmMFA enables two-factor authentication and returns a fresh set of
+// recovery codes. They are only ever shown this once.
+func (s *UserService) ConfirmMFA(ctx context.Context, userUUID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.GetByUUID(ctx, userUUID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	now := time.Now().UTC()
+	if err := s.userRepo.UpdateTOTP(ctx, user.UUID, user.TOTPSecret, &now); err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.UseTOTPStep(ctx, user.UUID, step); err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(ctx, user.UUID)
+}
+
+// DisableMFA turns two-factor authentication off after checking a current
+// code or a recovery code.
+func (s *UserService) DisableMFA(ctx context.Context, userUUID uuid.UUID, code string) error {
+	user, err := s.userRepo.GetByUUID(ctx, userUUID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled() {
+		return ErrMFANotEnabled
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdateTOTP(ctx, user.UUID, "", nil); err != nil {
+		return err
+	}
+	return s.oneTimeTokenRepo.InvalidateForUser(ctx, user.UUID, models.TokenPurposeMFARecovery)
+}
+
+// VerifyMFA completes a login that Authenticate answered with a challenge.
+// Each challenge can be exchanged for tokens only once.
+func (s *UserService) VerifyMFA(ctx context.Context, challenge, code, ip string) (*models.LoginResult, error) {
+	claims, err := s.parseMFAChallenge(challenge)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	revoked, err := s.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	user, err := s.userRepo.GetByUUID(ctx, claims.UserUUID)
+	if err != nil || !user.MFAEnabled() || user.IsSuspended() {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	ok, err := s.throttle.Attempt(ctx, user.UUID, ip, func(ctx context.Context) (bool, error) {
+		err := s.verifySecondFactor(ctx, user, code)
+		if errors.Is(err, ErrInvalidMFACode) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	if err := s.revocations.Revoke(ctx, claims); err != nil {
+		return nil, err
+	}
+	if err := s.throttle.Unlock(ctx, user.UUID); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, user, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResult{UserUUID: user.UUID, Tokens: tokens}, nil
+}
+
+// verifySecondFactor accepts either a TOTP code, at most once, or an unused
+// recovery code.
+func (s *UserService) verifySecondFactor(ctx context.Context, user *models.User, code string) error {
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), totpSkew); ok {
+		fresh, err := s.userRepo.UseTOTPStep(ctx, user.UUID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return ErrInvalidMFACode
+	}
+	// Check the owner before using the code up, so that submitting somebody
+	// else's recovery code cannot burn it.
+	stored, err := s.oneTimeTokenRepo.Get(ctx, hashToken(normalized), models.TokenPurposeMFARecovery)
+	if err != nil || stored.UserUUID != user.UUID {
+		return ErrInvalidMFACode
+	}
+	if _, err := s.oneTimeTokenRepo.Consume(ctx, stored.TokenHash, models.TokenPurposeMFARecovery); err != nil {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *UserService) replaceRecoveryCodes(ctx context.Context, userUUID uuid.UUID) ([]string, error) {
+	if err := s.oneTimeTokenRepo.InvalidateForUser(ctx, userUUID, models.TokenPurposeMFARecovery); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.oneTimeTokenRepo.Create(ctx, &models.OneTimeToken{
+			TokenHash: hashToken(normalizeRecoveryCode(code)),
+			UserUUID:  userUUID,
+			Purpose:   models.TokenPurposeMFARecovery,
+			ExpiresAt: time.Now().Add(recoveryCodeLifetime),
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns 80 random bits formatted as xxxx-xxxx-xxxx-xxxx.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+	groups := make([]string, 0, 4)
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// generateMFAChallenge signs the challenge with the server-only challenge key,
+// so that it cannot pass for an access token anywhere the JWKS is trusted.
+func (s *UserService) generateMFAChallenge(user *models.User) (string, error) {
+	now := time.Now()
+	expirationTime := now.Add(time.Duration(config.GetConfig().Auth.MFAChallengeExpiration) * time.Second)
+	claims := jwt.MapClaims{
+		"jti":     uuid.NewString(),
+		"typ":     tokenTypeMFAChallenge,
+		"user_id": user.UUID,
+		"iat":     numericDate(now),
+		"exp":     expirationTime.Unix(),
+	}
+	return s.challengeKeys.Sign(claims)
+}
+
+func (s *UserService) parseMFAChallenge(challenge string) (*models.AccessTokenClaims, error) {
+	claims := jwt.MapClaims{}
+	if err := s.challengeKeys.Parse(challenge, claims); err != nil {
+		return nil, err
+	}
+	return claimsFromMap(claims, tokenTypeMFAChallenge)
+}
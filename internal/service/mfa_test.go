@@ -0,0 +1,97 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/service"
+	"github.com/Gezubov/user_service/pkg/totp"
+)
+
+const testIP = "203.0.113.7"
+
+// enableMFA turns two-factor authentication on for user and returns the
+// recovery codes.
+func (e *testEnv) enableMFA(t *testing.T, user *models.User) []string {
+	t.Helper()
+	ctx := context.Background()
+
+	enrollment, err := e.users.EnrollMFA(ctx, user.UUID)
+	if err != nil {
+		t.Fatalf("EnrollMFA: %v", err)
+	}
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("totp.Code: %v", err)
+	}
+	codes, err := e.users.ConfirmMFA(ctx, user.UUID, code)
+	if err != nil {
+		t.Fatalf("ConfirmMFA: %v", err)
+	}
+	return codes
+}
+
+// login authenticates with password and returns the two-factor challenge.
+func (e *testEnv) login(t *testing.T, user *models.User, password string) string {
+	t.Helper()
+
+	result, err := e.users.Authenticate(context.Background(), user.Username, password, testIP)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if result.MFAChallenge == "" {
+		t.Fatal("Authenticate issued tokens without a two-factor challenge")
+	}
+	return result.MFAChallenge
+}
+
+// TestVerifyMFAAfterPasswordReset logs in within the same second as the
+// reset that ended every earlier session, so a challenge whose iat is cut to
+// whole seconds would be taken for a revoked one.
+func TestVerifyMFAAfterPasswordReset(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	user := env.register(t, "alice")
+	codes := env.enableMFA(t, user)
+
+	if err := env.users.RequestPasswordReset(ctx, user.Email); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	token := linkToken(t, env.mailer.next(t, user.Email, "Reset your password"))
+
+	const newPassword = "Another-Horse-7-staple"
+	if err := env.users.ResetPassword(ctx, token, newPassword); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	challenge := env.login(t, user, newPassword)
+	result, err := env.users.VerifyMFA(ctx, challenge, codes[0], testIP)
+	if err != nil {
+		t.Fatalf("VerifyMFA right after a password reset: %v", err)
+	}
+	if result.Tokens == nil {
+		t.Error("VerifyMFA issued no tokens")
+	}
+}
+
+func TestVerifyMFARejectsOtherUsersRecoveryCode(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	alice := env.register(t, "alice")
+	bob := env.register(t, "bob")
+	env.enableMFA(t, alice)
+	bobCodes := env.enableMFA(t, bob)
+
+	challenge := env.login(t, alice, testPassword)
+	if _, err := env.users.VerifyMFA(ctx, challenge, bobCodes[0], testIP); !errors.Is(err, service.ErrInvalidMFACode) {
+		t.Fatalf("VerifyMFA with another user's recovery code = %v, want %v", err, service.ErrInvalidMFACode)
+	}
+
+	challenge = env.login(t, bob, testPassword)
+	if _, err := env.users.VerifyMFA(ctx, challenge, bobCodes[0], testIP); err != nil {
+		t.Fatalf("recovery code no longer works for its owner: %v", err)
+	}
+}
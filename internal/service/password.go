@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/google/uuid"
+)
+
+var ErrCurrentPasswordIncorrect = errors.New("current password is incorrect")
+
+// PasswordHasher produces and checks self-describing password hashes. A hash
+// made with an outdated algorithm or weaker parameters than the configured
+// ones needs a rehash.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// ChangePassword replaces the password of a logged-in user. Every session is
+// ended, including the access token in claims, and a fresh token pair is
+// returned so the caller stays logged in on the device that made the change.
+func (s *UserService) ChangePassword(ctx context.Context, claims *models.AccessTokenClaims, currentPassword, newPassword, ip string) (*models.TokenPair, error) {
+	user, err := s.userRepo.GetByUUID(ctx, claims.UserUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.throttle.Attempt(ctx, user.UUID, ip, func(ctx context.Context) (bool, error) {
+		return s.checkPassword(currentPassword, user.PasswordHash), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCurrentPasswordIncorrect
+	}
+
+	if err := s.passwordPolicy.Validate(newPassword, user); err != nil {
+		return nil, err
+	}
+	if err := s.setPassword(ctx, user.UUID, newPassword); err != nil {
+		return nil, err
+	}
+	if err := s.LogoutAll(ctx, user.UUID); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, uuid.Nil)
+}
+
+func (s *UserService) setPassword(ctx context.Context, userUUID uuid.UUID, password string) error {
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	return s.userRepo.UpdatePassword(ctx, userUUID, hash, time.Now())
+}
+
+func (s *UserService) checkPassword(password, hash string) bool {
+	ok, err := s.hasher.Verify(password, hash)
+	if err != nil {
+		slog.Error("Error verifying password hash", "error", err)
+		return false
+	}
+	return ok
+}
+
+// rehashIfNeeded upgrades the stored hash after a successful login, while the
+// plain password is at hand. Failing to do so must not fail the login.
+func (s *UserService) rehashIfNeeded(ctx context.Context, user *models.User, password string) {
+	if !s.hasher.NeedsRehash(user.PasswordHash) {
+		return
+	}
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		slog.Error("Error rehashing password", "uuid", user.UUID, "error", err)
+		return
+	}
+	if err := s.userRepo.RehashPassword(ctx, user.UUID, user.PasswordHash, hash); err != nil {
+		slog.Warn("Unable to store rehashed password", "uuid", user.UUID, "error", err)
+		return
+	}
+	user.PasswordHash = hash
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/pkg/strength"
+)
+
+// bcrypt ignores everything past the first 72 bytes, so longer passwords
+// would silently be truncated.
+const maxPasswordBytes = 72
+
+// Codes reported in models.FieldError for the password field.
+const (
+	PasswordRequired             = "PASSWORD_REQUIRED"
+	PasswordTooShort             = "PASSWORD_TOO_SHORT"
+	PasswordTooLong              = "PASSWORD_TOO_LONG"
+	PasswordTooWeak              = "PASSWORD_TOO_WEAK"
+	PasswordContainsPersonalInfo = "PASSWORD_CONTAINS_PERSONAL_INFO"
+	PasswordBreached             = "PASSWORD_BREACHED"
+)
+
+// BreachedPasswords looks passwords up in a corpus of leaked ones.
+type BreachedPasswords interface {
+	IsBreached(password string) (bool, error)
+}
+
+// PasswordPolicy decides which new passwords are acceptable. MinScore is on
+// the 0-4 scale of pkg/strength. Breached may be nil to skip that check.
+type PasswordPolicy struct {
+	MinLength int
+	MinScore  int
+	Breached  BreachedPasswords
+}
+
+// Validate returns a *models.ValidationError listing every rule the password
+// breaks for the given user, or nil.
+func (p *PasswordPolicy) Validate(password string, user *models.User) error {
+	v := &models.ValidationError{}
+
+	if password == "" {
+		v.Add("password", PasswordRequired, "password is required")
+		return v
+	}
+	if utf8.RuneCountInString(password) < p.MinLength {
+		v.Add("password", PasswordTooShort, "password must be at least "+strconv.Itoa(p.MinLength)+" characters long")
+	}
+	// The password is rejected anyway, so do not spend time scoring or
+	// looking up input of any length.
+	if len(password) > maxPasswordBytes {
+		v.Add("password", PasswordTooLong, "password must be at most "+strconv.Itoa(maxPasswordBytes)+" bytes long")
+		return v
+	}
+
+	personal := personalInfo(user)
+	if containsAny(strings.ToLower(password), personal) {
+		v.Add("password", PasswordContainsPersonalInfo, "password must not contain your username or email")
+	} else if strength.Score(password, personal...) < p.MinScore {
+		v.Add("password", PasswordTooWeak, "password is too easy to guess")
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			v.Add("password", PasswordBreached, "password has appeared in a data breach")
+		}
+	}
+
+	return v.Err()
+}
+
+// personalInfo returns the lower-cased parts of the account an attacker
+// would try first. Very short parts are left out so they do not reject half
+// of all passwords.
+func personalInfo(user *models.User) []string {
+	if user == nil {
+		return nil
+	}
+
+	var parts []string
+	for _, part := range []string{user.Username, user.Email, localPart(user.Email)} {
+		if part = strings.ToLower(part); utf8.RuneCountInString(part) >= 3 {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func localPart(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+	return local
+}
+
+func containsAny(s string, parts []string) bool {
+	for _, part := range parts {
+		if strings.Contains(s, part) {
+			return true
+		}
+	}
+	return false
+}
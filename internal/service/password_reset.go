@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/validation"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+)
+
+type OneTimeTokenStorage interface {
+	Create(ctx context.Context, token *models.OneTimeToken) error
+	Get(ctx context.Context, hash, purpose string) (*models.OneTimeToken, error)
+	Consume(ctx context.Context, hash, purpose string) (*models.OneTimeToken, error)
+	InvalidateForUser(ctx context.Context, userUUID uuid.UUID, purpose string) error
+	// DeleteExpired removes tokens that expired before the given moment.
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg models.MailMessage) error
+}
+
+// RequestPasswordReset mails a reset link to the owner of the address. It
+// behaves the same whether or not the address is registered, so it cannot be
+// used to find out who has an account.
+func (s *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, validation.NormalizeEmail(email))
+	if err != nil {
+		slog.Info("Password reset requested for unknown email")
+		return nil
+	}
+
+	return s.sendPasswordResetLink(ctx, user)
+}
+
+func (s *UserService) sendPasswordResetLink(ctx context.Context, user *models.User) error {
+	expiration := time.Duration(config.GetConfig().Auth.PasswordResetExpiration) * time.Second
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = s.oneTimeTokenRepo.Create(ctx, &models.OneTimeToken{
+		TokenHash: hashToken(token),
+		UserUUID:  user.UUID,
+		Purpose:   models.TokenPurposePasswordReset,
+		ExpiresAt: time.Now().Add(expiration),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := config.GetConfig().Server.FrontendURL + "/reset-password?token=" + url.QueryEscape(token)
+	s.sendMail(models.MailMessage{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Somebody asked to reset the password of your account. Follow the link below to choose a new one:\n\n"+
+			"%s\n\n"+
+			"The link expires in %s. If you did not ask for this, you can ignore this message.\n",
+			user.Username, link, expiration),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password using a token from RequestPasswordReset
+// and ends every existing session of the user.
+func (s *UserService) ResetPassword(ctx context.Context, token, password string) error {
+	// The token is only used up once the new password has passed the
+	// policy, so that the user can try again with a better one.
+	stored, err := s.oneTimeTokenRepo.Get(ctx, hashToken(token), models.TokenPurposePasswordReset)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.userRepo.GetByUUID(ctx, stored.UserUUID)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	if err := s.passwordPolicy.Validate(password, user); err != nil {
+		return err
+	}
+
+	return s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := s.oneTimeTokenRepo.Consume(ctx, stored.TokenHash, models.TokenPurposePasswordReset); err != nil {
+			return ErrInvalidResetToken
+		}
+		if err := s.setPassword(ctx, user.UUID, password); err != nil {
+			return err
+		}
+		if err := s.oneTimeTokenRepo.InvalidateForUser(ctx, user.UUID, models.TokenPurposePasswordReset); err != nil {
+			return err
+		}
+		return s.LogoutAll(ctx, user.UUID)
+	})
+}
+
+// sendMail delivers in the background so that response times do not reveal
+// whether a message was sent at all.
+func (s *UserService) sendMail(msg models.MailMessage) {
+	go func() {
+		ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+		defer cancel()
+
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			slog.Error("Error sending mail", "subject", msg.Subject, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/google/uuid"
+)
+
+type RevocationStorage interface {
+	RevokeToken(ctx context.Context, jti string, userUUID uuid.UUID, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeAllForUser(ctx context.Context, userUUID uuid.UUID, before time.Time) error
+	GetRevokedBefore(ctx context.Context, userUUID uuid.UUID) (time.Time, error)
+	// DeleteExpired forgets revoked tokens that expired before the given
+	// moment; they are rejected for their expiry alone.
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+// RevocationList answers "is this access token still allowed?" with Postgres
+// as the source of truth. Revoked tokens are cached until they expire anyway;
+// negative answers are cached for cacheTTL only, which bounds how long another
+// instance may keep accepting a token revoked elsewhere. Revocations made
+// through this instance take effect immediately.
+type RevocationList struct {
+	repo     RevocationStorage
+	cacheTTL time.Duration
+
+	mu         sync.Mutex
+	revoked    map[string]time.Time
+	notRevoked map[string]time.Time
+	cutoffs    map[uuid.UUID]cachedCutoff
+	lastSweep  time.Time
+}
+
+type cachedCutoff struct {
+	before    time.Time
+	fetchedAt time.Time
+}
+
+func NewRevocationList(repo RevocationStorage, cacheTTL time.Duration) *RevocationList {
+	return &RevocationList{
+		repo:       repo,
+		cacheTTL:   cacheTTL,
+		revoked:    make(map[string]time.Time),
+		notRevoked: make(map[string]time.Time),
+		cutoffs:    make(map[uuid.UUID]cachedCutoff),
+	}
+}
+
+func (l *RevocationList) Revoke(ctx context.Context, claims *models.AccessTokenClaims) error {
+	if err := l.repo.RevokeToken(ctx, claims.TokenID, claims.UserUUID, claims.ExpiresAt); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.revoked[claims.TokenID] = claims.ExpiresAt
+	delete(l.notRevoked, claims.TokenID)
+	return nil
+}
+
+// RevokeAllForUser invalidates every access token the user holds right now.
+func (l *RevocationList) RevokeAllForUser(ctx context.Context, userUUID uuid.UUID) error {
+	now := time.Now()
+	if err := l.repo.RevokeAllForUser(ctx, userUUID, now); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cutoffs[userUUID] = cachedCutoff{before: now, fetchedAt: now}
+	return nil
+}
+
+func (l *RevocationList) IsRevoked(ctx context.Context, claims *models.AccessTokenClaims) (bool, error) {
+	before, err := l.revokedBefore(ctx, claims.UserUUID)
+	if err != nil {
+		return false, err
+	}
+	// iat has microsecond precision. A token issued in the same microsecond
+	// as the cutoff counts as revoked.
+	if !claims.IssuedAt.After(before.Truncate(time.Microsecond)) {
+		return true, nil
+	}
+
+	return l.isTokenRevoked(ctx, claims.TokenID, claims.ExpiresAt)
+}
+
+func (l *RevocationList) isTokenRevoked(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	l.sweep(now)
+	if _, ok := l.revoked[jti]; ok {
+		l.mu.Unlock()
+		return true, nil
+	}
+	if until, ok := l.notRevoked[jti]; ok && now.Before(until) {
+		l.mu.Unlock()
+		return false, nil
+	}
+	l.mu.Unlock()
+
+	revoked, err := l.repo.IsTokenRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if revoked {
+		l.revoked[jti] = expiresAt
+	} else if l.cacheTTL > 0 {
+		l.notRevoked[jti] = now.Add(l.cacheTTL)
+	}
+	return revoked, nil
+}
+
+func (l *RevocationList) revokedBefore(ctx context.Context, userUUID uuid.UUID) (time.Time, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	cached, ok := l.cutoffs[userUUID]
+	l.mu.Unlock()
+	if ok && now.Sub(cached.fetchedAt) < l.cacheTTL {
+		return cached.before, nil
+	}
+
+	before, err := l.repo.GetRevokedBefore(ctx, userUUID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current, ok := l.cutoffs[userUUID]; ok && current.before.After(before) {
+		before = current.before
+	}
+	l.cutoffs[userUUID] = cachedCutoff{before: before, fetchedAt: now}
+	return before, nil
+}
+
+// sweep drops expired cache entries. It must be called with l.mu held.
+func (l *RevocationList) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for jti, expiresAt := range l.revoked {
+		if now.After(expiresAt) {
+			delete(l.revoked, jti)
+		}
+	}
+	for jti, until := range l.notRevoked {
+		if now.After(until) {
+			delete(l.notRevoked, jti)
+		}
+	}
+	for userUUID, cached := range l.cutoffs {
+		if now.Sub(cached.fetchedAt) >= l.cacheTTL {
+			delete(l.cutoffs, userUUID)
+		}
+	}
+}
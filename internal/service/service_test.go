@@ -0,0 +1,151 @@
+package service_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/infrastructure/jwtkeys"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/service"
+	"github.com/Gezubov/user_service/internal/storage/memory"
+	"github.com/Gezubov/user_service/pkg/passhash"
+)
+
+const testPassword = "Correct-Horse-9-battery"
+
+// fakeMailer hands every message it is asked to send to the test.
+type fakeMailer struct {
+	sent chan models.MailMessage
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg models.MailMessage) error {
+	m.sent <- msg
+	return nil
+}
+
+// next waits for the next message with the given subject sent to the given
+// address, skipping any other.
+func (m *fakeMailer) next(t *testing.T, to, subject string) models.MailMessage {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-m.sent:
+			if msg.To == to && msg.Subject == subject {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("no mail %q sent to %s", subject, to)
+		}
+	}
+}
+
+// none checks that nothing is sent within a short while.
+func (m *fakeMailer) none(t *testing.T) {
+	t.Helper()
+
+	select {
+	case msg := <-m.sent:
+		t.Fatalf("unexpected mail %q to %s", msg.Subject, msg.To)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// linkToken extracts the token query parameter of the link in a mail body.
+func linkToken(t *testing.T, msg models.MailMessage) string {
+	t.Helper()
+
+	_, rest, ok := strings.Cut(msg.Body, "token=")
+	if !ok {
+		t.Fatalf("mail %q has no token link", msg.Subject)
+	}
+	token, _, _ := strings.Cut(rest, "\n")
+	token, err := url.QueryUnescape(token)
+	if err != nil {
+		t.Fatalf("mail %q: %v", msg.Subject, err)
+	}
+	return token
+}
+
+type testEnv struct {
+	users  *service.UserService
+	mailer *fakeMailer
+}
+
+// testOptions adjusts the service built by newTestEnvWith.
+type testOptions struct {
+	// wrapUsers, when set, is applied to the user storage.
+	wrapUsers func(service.UserStorage) service.UserStorage
+	// wrapFailures, when set, is applied to the login failure storage.
+	wrapFailures func(service.LoginFailureStorage) service.LoginFailureStorage
+	lockout      service.LockoutPolicy
+}
+
+// newTestEnv runs a UserService on in-memory storage with cheap password
+// hashing and no lockout.
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	return newTestEnvWith(t, testOptions{})
+}
+
+// newTestEnvWith is newTestEnv adjusted by opts.
+func newTestEnvWith(t *testing.T, opts testOptions) *testEnv {
+	t.Helper()
+
+	cfg := config.GetConfig()
+	cfg.JWT.Expiration = 900
+	cfg.JWT.RefreshExpiration = 3600
+	cfg.Auth.PasswordResetExpiration = 3600
+	cfg.Auth.EmailVerificationExpiration = 3600
+	cfg.Auth.MFAChallengeExpiration = 300
+
+	ctx := context.Background()
+	db := memory.New()
+	var userRepo service.UserStorage = memory.NewUserStorage(ctx, db)
+	if opts.wrapUsers != nil {
+		userRepo = opts.wrapUsers(userRepo)
+	}
+	var failureRepo service.LoginFailureStorage = memory.NewLoginFailureStorage(ctx, db)
+	if opts.wrapFailures != nil {
+		failureRepo = opts.wrapFailures(failureRepo)
+	}
+	keys, err := jwtkeys.Load(&config.JWTConfig{Secret: "access-token-secret-of-32-bytes!"})
+	if err != nil {
+		t.Fatalf("loading keys: %v", err)
+	}
+	challengeKey, err := jwtkeys.LoadSecretKey("challenge-secret-of-at-least-32b")
+	if err != nil {
+		t.Fatalf("loading challenge key: %v", err)
+	}
+
+	mailer := &fakeMailer{sent: make(chan models.MailMessage, 16)}
+	users := service.NewUserService(ctx,
+		userRepo,
+		memory.NewTokenStorage(ctx, db),
+		memory.NewOneTimeTokenStorage(ctx, db),
+		service.NewRevocationList(memory.NewRevocationStorage(ctx, db), time.Minute),
+		service.NewLoginThrottle(failureRepo, opts.lockout),
+		&service.PasswordPolicy{MinLength: 8},
+		passhash.NewChain(passhash.Bcrypt{Cost: 4}),
+		mailer,
+		keys,
+		challengeKey,
+	)
+	return &testEnv{users: users, mailer: mailer}
+}
+
+// register creates a user with testPassword.
+func (e *testEnv) register(t *testing.T, username string) *models.User {
+	t.Helper()
+
+	user := &models.User{Username: username, Email: username + "@example.com"}
+	if err := e.users.CreateUser(context.Background(), user, testPassword); err != nil {
+		t.Fatalf("CreateUser(%s): %v", username, err)
+	}
+	return user
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+type TokenStorage interface {
+	Create(ctx context.Context, token *models.RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (*models.RefreshToken, error)
+	MarkRotated(ctx context.Context, tokenUUID uuid.UUID) (bool, error)
+	RevokeFamily(ctx context.Context, familyUUID uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userUUID uuid.UUID) error
+	// DeleteExpired removes tokens that expired before the given moment.
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+// Refresh exchanges a refresh token for a new token pair. Every refresh token
+// is single-use: presenting one that was already rotated revokes the whole
+// family, logging out both the legitimate client and whoever copied it.
+func (s *UserService) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	stored, err := s.tokenRepo.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if stored.RotatedAt != nil {
+		return nil, s.revokeReusedFamily(ctx, stored)
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	rotated, err := s.tokenRepo.MarkRotated(ctx, stored.UUID)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		return nil, s.revokeReusedFamily(ctx, stored)
+	}
+
+	user, err := s.userRepo.GetByUUID(ctx, stored.UserUUID)
+	if err != nil || user.IsSuspended() {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.issueTokens(ctx, user, stored.FamilyUUID)
+}
+
+// Logout ends the current session: the access token is revoked right away and
+// the refresh token family it belongs to can no longer be used.
+func (s *UserService) Logout(ctx context.Context, claims *models.AccessTokenClaims, refreshToken string) error {
+	if err := s.revocations.Revoke(ctx, claims); err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	stored, err := s.tokenRepo.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil || stored.UserUUID != claims.UserUUID {
+		return nil
+	}
+	return s.tokenRepo.RevokeFamily(ctx, stored.FamilyUUID)
+}
+
+// LogoutAll ends every session of the user on every device.
+func (s *UserService) LogoutAll(ctx context.Context, userUUID uuid.UUID) error {
+	if err := s.tokenRepo.RevokeAllForUser(ctx, userUUID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeAllForUser(ctx, userUUID)
+}
+
+func (s *UserService) revokeReusedFamily(ctx context.Context, token *models.RefreshToken) error {
+	slog.Warn("Refresh token reuse detected", "user_uuid", token.UserUUID, "family_uuid", token.FamilyUUID)
+	if err := s.tokenRepo.RevokeFamily(ctx, token.FamilyUUID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// issueTokens signs a new access token and stores a new refresh token in the
+// given family. Pass uuid.Nil to start a new family, i.e. a new session.
+func (s *UserService) issueTokens(ctx context.Context, user *models.User, familyUUID uuid.UUID) (*models.TokenPair, error) {
+	accessToken, accessExpiresAt, err := s.generateJWT(user)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := generateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if familyUUID == uuid.Nil {
+		familyUUID = uuid.New()
+	}
+	refreshExpiresAt := time.Now().Add(time.Duration(config.GetConfig().JWT.RefreshExpiration) * time.Second)
+	err = s.tokenRepo.Create(ctx, &models.RefreshToken{
+		UserUUID:   user.UUID,
+		FamilyUUID: familyUUID,
+		TokenHash:  hashToken(refreshToken),
+		ExpiresAt:  refreshExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// generateOpaqueToken returns 256 random bits, URL-safe encoded.
+func generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is used for opaque high-entropy tokens only; a fast hash is
+// enough there, unlike for passwords.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
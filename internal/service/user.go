@@ -5,116 +5,247 @@ import (
 	"errors"
 	"time"
 
-	"github.com/Gezubov/user_service/config"
 	"github.com/Gezubov/user_service/internal/models"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/Gezubov/user_service/internal/validation"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-var ErrInvalidCredentials = errors.New("invalid email or password")
+var (
+	ErrInvalidCredentials    = errors.New("invalid email or password")
+	ErrAccountSuspended      = errors.New("account suspended")
+	ErrPasswordResetRequired = errors.New("password reset required")
+)
 
 type UserStorage interface {
+	// WithTx runs fn in a transaction. Storage calls made with the context
+	// passed to fn, on any storage, take part in it.
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
 	Create(ctx context.Context, user *models.User) error
 	GetByUUID(ctx context.Context, uuid uuid.UUID) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	GetByUsername(ctx context.Context, username string) (*models.User, error)
 	Update(ctx context.Context, user *models.User) error
 	Delete(ctx context.Context, uuid uuid.UUID) error
-	GetAllUsers(ctx context.Context) ([]models.User, error)
+	List(ctx context.Context, filter models.UserFilter) ([]models.User, error)
+	Count(ctx context.Context, filter models.UserFilter) (int, error)
+	UpdateRole(ctx context.Context, uuid uuid.UUID, role string) error
+	UpdateSuspension(ctx context.Context, uuid uuid.UUID, suspendedAt *time.Time) error
+	UpdatePasswordResetRequired(ctx context.Context, uuid uuid.UUID, required bool) error
+	UpdatePassword(ctx context.Context, uuid uuid.UUID, hash string, changedAt time.Time) error
+	RehashPassword(ctx context.Context, uuid uuid.UUID, oldHash, newHash string) error
+	UpdatePendingEmail(ctx context.Context, uuid uuid.UUID, email string) error
+	MarkEmailVerified(ctx context.Context, uuid uuid.UUID, email string) error
+	UpdateTOTP(ctx context.Context, uuid uuid.UUID, secret string, enabledAt *time.Time) error
+	UseTOTPStep(ctx context.Context, uuid uuid.UUID, step int64) (bool, error)
+}
+
+// TokenKeys signs and verifies the JWTs issued by the service. Access tokens
+// use keys other services can verify; two-factor challenges use a separate
+// key that stays with the service.
+type TokenKeys interface {
+	Sign(claims jwt.Claims) (string, error)
+	Parse(token string, claims jwt.Claims) error
 }
 
 type UserService struct {
-	userRepo UserStorage
-	ctx      context.Context
+	userRepo         UserStorage
+	tokenRepo        TokenStorage
+	oneTimeTokenRepo OneTimeTokenStorage
+	revocations      *RevocationList
+	throttle         *LoginThrottle
+	passwordPolicy   *PasswordPolicy
+	hasher           PasswordHasher
+	mailer           Mailer
+	keys             TokenKeys
+	challengeKeys    TokenKeys
+	ctx              context.Context
 }
 
-func NewUserService(ctx context.Context, userRepo UserStorage) *UserService {
+func NewUserService(
+	ctx context.Context,
+	userRepo UserStorage,
+	tokenRepo TokenStorage,
+	oneTimeTokenRepo OneTimeTokenStorage,
+	revocations *RevocationList,
+	throttle *LoginThrottle,
+	passwordPolicy *PasswordPolicy,
+	hasher PasswordHasher,
+	mailer Mailer,
+	keys TokenKeys,
+	challengeKeys TokenKeys,
+) *UserService {
 	return &UserService{
-		ctx:      ctx,
-		userRepo: userRepo,
+		ctx:              ctx,
+		userRepo:         userRepo,
+		tokenRepo:        tokenRepo,
+		oneTimeTokenRepo: oneTimeTokenRepo,
+		revocations:      revocations,
+		throttle:         throttle,
+		passwordPolicy:   passwordPolicy,
+		hasher:           hasher,
+		mailer:           mailer,
+		keys:             keys,
+		challengeKeys:    challengeKeys,
 	}
 }
 
+// CreateUser registers a new account. Uniqueness of the username and email is
+// left to the database, which reports clashes as storage.ErrUsernameTaken or
+// storage.ErrEmailTaken.
 func (s *UserService) CreateUser(ctx context.Context, user *models.User, password string) error {
-	existingUserByUsername, err := s.userRepo.GetByUsername(ctx, user.Username)
-	if err == nil && existingUserByUsername != nil {
-		return errors.New("имя пользователя уже занято")
-	}
+	user.Username = validation.NormalizeUsername(user.Username)
+	user.Email = validation.NormalizeEmail(user.Email)
 
-	existingUserByEmail, err := s.userRepo.GetByEmail(ctx, user.Email)
-	if err == nil && existingUserByEmail != nil {
-		return errors.New("почта уже занята")
+	if err := s.passwordPolicy.Validate(password, user); err != nil {
+		return err
 	}
 
-	hash, err := HashPassword(password)
+	hash, err := s.hasher.Hash(password)
 	if err != nil {
 		return err
 	}
 	user.PasswordHash = hash
-	user.Role = "user"
-	return s.userRepo.Create(ctx, user)
+	user.Role = models.RoleUser
+
+	var msg *models.MailMessage
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return err
+		}
+		var err error
+		msg, err = s.verificationMail(ctx, user, user.Email)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(*msg)
+	return nil
 }
 
 func (s *UserService) GetUserByID(ctx context.Context, uuid uuid.UUID) (*models.User, error) {
 	return s.userRepo.GetByUUID(ctx, uuid)
 }
 
+// UpdateUser saves the user. A changed email is not applied directly but
+// becomes pending until the new address is verified; setting it back to the
+// current one drops the pending change. An empty email leaves both alone.
 func (s *UserService) UpdateUser(ctx context.Context, user *models.User) error {
-	return s.userRepo.Update(ctx, user)
+	existing, err := s.userRepo.GetByUUID(ctx, user.UUID)
+	if err != nil {
+		return err
+	}
+
+	user.Username = validation.NormalizeUsername(user.Username)
+	newEmail := validation.NormalizeEmail(user.Email)
+	user.Email = existing.Email
+
+	var msg *models.MailMessage
+	err = s.userRepo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return err
+		}
+
+		switch newEmail {
+		case "", existing.PendingEmail:
+			return nil
+		case existing.Email:
+			if existing.PendingEmail == "" {
+				return nil
+			}
+			if err := s.userRepo.UpdatePendingEmail(ctx, user.UUID, ""); err != nil {
+				return err
+			}
+			user.PendingEmail = ""
+			return s.oneTimeTokenRepo.InvalidateForUser(ctx, user.UUID, models.TokenPurposeEmailVerification)
+		}
+
+		var err error
+		msg, err = s.requestEmailChange(ctx, user, newEmail)
+		return err
+	})
+	if err != nil || msg == nil {
+		return err
+	}
+
+	s.sendMail(*msg)
+	return nil
 }
 
 func (s *UserService) DeleteUser(ctx context.Context, uuid uuid.UUID) error {
 	return s.userRepo.Delete(ctx, uuid)
 }
 
-func (s *UserService) GetAllUsers(ctx context.Context) ([]models.User, error) {
-	return s.userRepo.GetAllUsers(ctx)
-}
-
 func (s *UserService) GetByEmail(ctx context.Context, email string) (*models.User, error) {
-	return s.userRepo.GetByEmail(ctx, email)
+	return s.userRepo.GetByEmail(ctx, validation.NormalizeEmail(email))
 }
 
 func (s *UserService) GetByUsername(ctx context.Context, username string) (*models.User, error) {
-	return s.userRepo.GetByUsername(ctx, username)
+	return s.userRepo.GetByUsername(ctx, validation.NormalizeUsername(username))
 }
 
-func (s *UserService) Authenticate(ctx context.Context, identifier, password string) (string, error) {
+// Authenticate checks the credentials of a login attempt made from the given
+// client IP and starts a session. When the user has two-factor authentication
+// enabled, the result holds a challenge for VerifyMFA instead of tokens.
+// Failures count towards the lockout of both the account and the IP; while
+// either is locked a *LoginLockedError is returned without looking at the
+// password.
+func (s *UserService) Authenticate(ctx context.Context, identifier, password, ip string) (*models.LoginResult, error) {
 	var user *models.User
 	var err error
 
-	user, err = s.userRepo.GetByEmail(ctx, identifier)
+	user, err = s.userRepo.GetByEmail(ctx, validation.NormalizeEmail(identifier))
 	if err != nil {
-		user, err = s.userRepo.GetByUsername(ctx, identifier)
+		user, err = s.userRepo.GetByUsername(ctx, validation.NormalizeUsername(identifier))
 	}
 
 	if err != nil {
-		return "", ErrInvalidCredentials
+		_, err := s.throttle.Attempt(ctx, uuid.Nil, ip, func(ctx context.Context) (bool, error) {
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
 	}
 
-	if !CheckPasswordHash(password, user.PasswordHash) {
-		return "", ErrInvalidCredentials
+	ok, err := s.throttle.Attempt(ctx, user.UUID, ip, func(ctx context.Context) (bool, error) {
+		return s.checkPassword(password, user.PasswordHash), nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return generateJWT(user)
-}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	s.rehashIfNeeded(ctx, user, password)
 
-func generateJWT(user *models.User) (string, error) {
-	expirationTime := time.Now().Add(time.Duration(config.GetConfig().JWT.Expiration) * time.Second)
-	claims := jwt.MapClaims{
-		"user_id": user.UUID,
-		"exp":     expirationTime.Unix(),
+	if user.IsSuspended() {
+		return nil, ErrAccountSuspended
+	}
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.GetConfig().JWT.Secret))
-}
 
-func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hash), err
-}
+	if user.MFAEnabled() {
+		// The password was right but the account stays under watch until
+		// the second factor is verified too.
+		challenge, err := s.generateMFAChallenge(user)
+		if err != nil {
+			return nil, err
+		}
+		return &models.LoginResult{UserUUID: user.UUID, MFAChallenge: challenge}, nil
+	}
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	if err := s.throttle.Unlock(ctx, user.UUID); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, user, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResult{UserUUID: user.UUID, Tokens: tokens}, nil
 }
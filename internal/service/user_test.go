@@ -0,0 +1,82 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/service"
+)
+
+var errCommit = errors.New("commit failed")
+
+// failingCommits rolls back every transaction after its work is done, as a
+// failed commit would.
+type failingCommits struct {
+	service.UserStorage
+}
+
+func (s failingCommits) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.UserStorage.WithTx(ctx, func(ctx context.Context) error {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		return errCommit
+	})
+}
+
+func TestCreateUserSendsVerificationAfterCommit(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.register(t, "alice")
+	if linkToken(t, env.mailer.next(t, user.Email, "Confirm your email address")) == "" {
+		t.Error("verification mail has an empty token")
+	}
+
+	env = newTestEnvWith(t, testOptions{wrapUsers: func(users service.UserStorage) service.UserStorage {
+		return failingCommits{users}
+	}})
+	user = &models.User{Username: "bob", Email: "bob@example.com"}
+	if err := env.users.CreateUser(context.Background(), user, testPassword); !errors.Is(err, errCommit) {
+		t.Fatalf("CreateUser = %v, want %v", err, errCommit)
+	}
+	env.mailer.none(t)
+}
+
+func TestUpdateUserBackToCurrentEmailDropsPendingChange(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	user := env.register(t, "alice")
+	const newEmail = "alice@example.org"
+
+	user.Email = newEmail
+	if err := env.users.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("UpdateUser(new email): %v", err)
+	}
+	token := linkToken(t, env.mailer.next(t, newEmail, "Confirm your email address"))
+
+	// Updating something else keeps the change pending.
+	user.Username, user.Email = "alicia", ""
+	if err := env.users.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("UpdateUser(username): %v", err)
+	}
+	if user.PendingEmail != newEmail {
+		t.Fatalf("pending email after a username change = %q, want %q", user.PendingEmail, newEmail)
+	}
+
+	user.Email = "alice@example.com"
+	if err := env.users.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("UpdateUser(current email): %v", err)
+	}
+	if err := env.users.VerifyEmail(ctx, token); !errors.Is(err, service.ErrInvalidVerificationToken) {
+		t.Errorf("VerifyEmail with the abandoned link = %v, want %v", err, service.ErrInvalidVerificationToken)
+	}
+
+	stored, err := env.users.GetUserByID(ctx, user.UUID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if stored.Email != "alice@example.com" || stored.PendingEmail != "" {
+		t.Errorf("email = %q, pending = %q; want alice@example.com and none", stored.Email, stored.PendingEmail)
+	}
+}
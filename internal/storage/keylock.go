@@ -0,0 +1,44 @@
+package storage
+
+import "sync"
+
+// KeyLocks hands out one mutex per key, for storages that have no database
+// server to lock through. It only serializes callers within one process. The
+// zero value is ready to use.
+type KeyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu sync.Mutex
+	// refs counts the holder and the waiters; the lock is dropped when it
+	// reaches zero.
+	refs int
+}
+
+// Lock blocks until key is free and returns the function that frees it.
+func (l *KeyLocks) Lock(key string) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*keyLock)
+	}
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
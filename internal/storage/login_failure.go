@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type LoginFailureStorage struct {
+	db  *pgxpool.Pool
+	ctx context.Context
+}
+
+func NewLoginFailureStorage(ctx context.Context, db *pgxpool.Pool) *LoginFailureStorage {
+	return &LoginFailureStorage{ctx: ctx, db: db}
+}
+
+// WithLock runs fn in a transaction holding an advisory lock on the counters
+// of scope and subject. Postgres releases it when the transaction ends, so
+// the lock covers every instance sharing the database.
+func (r *LoginFailureStorage) WithLock(ctx context.Context, scope, subject string, fn func(ctx context.Context) error) error {
+	return WithTx(ctx, r.db, func(ctx context.Context) error {
+		query := `SELECT pg_advisory_xact_lock(hashtext($1), hashtext($2))`
+
+		if _, err := conn(ctx, r.db).Exec(ctx, query, scope, subject); err != nil {
+			slog.Error("Error locking login failures", "scope", scope, "subject", subject, "error", err)
+			return err
+		}
+		return fn(ctx)
+	})
+}
+
+// RecordFailure counts a failed attempt and returns the number of failures in
+// the current streak. A streak ends when no failure was recorded for the
+// given window and no lock is in force.
+func (r *LoginFailureStorage) RecordFailure(ctx context.Context, scope, subject string, window time.Duration) (int, error) {
+	query := `
+		INSERT INTO login_failures (scope, subject, failures, last_failed_at)
+		VALUES ($1, $2, 1, $3)
+		ON CONFLICT (scope, subject) DO UPDATE
+		SET failures = CASE
+				WHEN login_failures.last_failed_at < $4
+					AND COALESCE(login_failures.locked_until, $3) <= $3 THEN 1
+				ELSE login_failures.failures + 1
+			END,
+			last_failed_at = EXCLUDED.last_failed_at
+		RETURNING failures`
+
+	now := time.Now().UTC()
+	var failures int
+	if err := conn(ctx, r.db).QueryRow(ctx, query, scope, subject, now, now.Add(-window)).Scan(&failures); err != nil {
+		slog.Error("Error recording login failure", "scope", scope, "subject", subject, "error", err)
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (r *LoginFailureStorage) Lock(ctx context.Context, scope, subject string, until time.Time) error {
+	slog.Warn("Locking login", "scope", scope, "subject", subject, "until", until)
+	query := `UPDATE login_failures SET locked_until = $3 WHERE scope = $1 AND subject = $2`
+
+	if _, err := conn(ctx, r.db).Exec(ctx, query, scope, subject, until.UTC()); err != nil {
+		slog.Error("Error locking login", "scope", scope, "subject", subject, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetLockedUntil returns the zero time when there is no lock on record.
+func (r *LoginFailureStorage) GetLockedUntil(ctx context.Context, scope, subject string) (time.Time, error) {
+	query := `SELECT locked_until FROM login_failures WHERE scope = $1 AND subject = $2`
+
+	var lockedUntil *time.Time
+	err := conn(ctx, r.db).QueryRow(ctx, query, scope, subject).Scan(&lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && lockedUntil == nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		slog.Error("Error fetching login lock", "scope", scope, "subject", subject, "error", err)
+		return time.Time{}, err
+	}
+
+	return *lockedUntil, nil
+}
+
+// Reset forgets failures and lifts any lock.
+func (r *LoginFailureStorage) Reset(ctx context.Context, scope, subject string) error {
+	query := `DELETE FROM login_failures WHERE scope = $1 AND subject = $2`
+
+	if _, err := conn(ctx, r.db).Exec(ctx, query, scope, subject); err != nil {
+		slog.Error("Error resetting login failures", "scope", scope, "subject", subject, "error", err)
+		return err
+	}
+
+	return nil
+}
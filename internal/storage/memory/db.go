@@ -0,0 +1,148 @@
+// Package memory keeps the service's data in process memory. It behaves like
+// the Postgres storages, including uniqueness and not-found errors, and is
+// meant for tests, demos and local development. Nothing survives a restart.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/google/uuid"
+)
+
+// DB holds the data of every in-memory storage. Storages created from the
+// same DB can take part in one transaction, like the Postgres storages
+// sharing a pool.
+type DB struct {
+	mu sync.RWMutex
+
+	users         map[uuid.UUID]*models.User
+	refreshTokens map[uuid.UUID]*models.RefreshToken
+	revokedTokens map[string]revokedToken
+	revokedBefore map[uuid.UUID]time.Time
+	oneTimeTokens map[string]*models.OneTimeToken
+	loginFailures map[loginFailureKey]*loginFailure
+
+	// loginLocks serializes login attempts per counter; see
+	// LoginFailureStorage.WithLock.
+	loginLocks storage.KeyLocks
+}
+
+func New() *DB {
+	return &DB{
+		users:         map[uuid.UUID]*models.User{},
+		refreshTokens: map[uuid.UUID]*models.RefreshToken{},
+		revokedTokens: map[string]revokedToken{},
+		revokedBefore: map[uuid.UUID]time.Time{},
+		oneTimeTokens: map[string]*models.OneTimeToken{},
+		loginFailures: map[loginFailureKey]*loginFailure{},
+	}
+}
+
+type txKey struct{}
+
+// tx is a transaction in progress. It holds the write lock of its DB until it
+// ends and remembers how to undo every change made so far.
+type tx struct {
+	db   *DB
+	undo []func()
+}
+
+// WithTx runs fn in a transaction carried by the context it is given: every
+// call made with that context on a storage of this DB joins it. Changes are
+// undone when fn returns an error or panics. Nested calls join the outer
+// transaction.
+//
+// Transactions are serialized, so they never see each other's changes.
+func (db *DB) WithTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if db.inTx(ctx) {
+		return fn(ctx)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := &tx{db: db}
+	committed := false
+	defer func() {
+		if !committed {
+			for i := len(t.undo) - 1; i >= 0; i-- {
+				t.undo[i]()
+			}
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, t)); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+func (db *DB) inTx(ctx context.Context) bool {
+	t, ok := ctx.Value(txKey{}).(*tx)
+	return ok && t.db == db
+}
+
+// read locks db for reading and returns the matching unlock. Inside a
+// transaction the lock is already held.
+func (db *DB) read(ctx context.Context) func() {
+	if db.inTx(ctx) {
+		return func() {}
+	}
+	db.mu.RLock()
+	return db.mu.RUnlock
+}
+
+// write locks db for writing and returns the matching unlock. Inside a
+// transaction the lock is already held.
+func (db *DB) write(ctx context.Context) func() {
+	if db.inTx(ctx) {
+		return func() {}
+	}
+	db.mu.Lock()
+	return db.mu.Unlock
+}
+
+// onRollback registers undo with the transaction in ctx, if any.
+func (db *DB) onRollback(ctx context.Context, undo func()) {
+	if t, ok := ctx.Value(txKey{}).(*tx); ok && t.db == db {
+		t.undo = append(t.undo, undo)
+	}
+}
+
+// set stores value under key so that a rollback restores the previous entry.
+// Stored values are replaced, never modified in place, which keeps the
+// previous entry intact for the undo.
+func set[K comparable, V any](ctx context.Context, db *DB, m map[K]V, key K, value V) {
+	prev, existed := m[key]
+	m[key] = value
+	db.onRollback(ctx, func() {
+		if existed {
+			m[key] = prev
+		} else {
+			delete(m, key)
+		}
+	})
+}
+
+// remove deletes key so that a rollback restores it.
+func remove[K comparable, V any](ctx context.Context, db *DB, m map[K]V, key K) {
+	prev, existed := m[key]
+	if !existed {
+		return
+	}
+	delete(m, key)
+	db.onRollback(ctx, func() { m[key] = prev })
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
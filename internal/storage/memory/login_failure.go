@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+type loginFailureKey struct {
+	scope   string
+	subject string
+}
+
+type loginFailure struct {
+	failures     int
+	lastFailedAt time.Time
+	lockedUntil  time.Time
+}
+
+type LoginFailureStorage struct {
+	db  *DB
+	ctx context.Context
+}
+
+func NewLoginFailureStorage(ctx context.Context, db *DB) *LoginFailureStorage {
+	return &LoginFailureStorage{ctx: ctx, db: db}
+}
+
+// WithLock runs fn while no other WithLock call for the same scope and
+// subject runs. fn is not a transaction; its changes stay when it fails.
+func (r *LoginFailureStorage) WithLock(ctx context.Context, scope, subject string, fn func(ctx context.Context) error) error {
+	defer r.db.loginLocks.Lock(scope + ":" + subject)()
+	return fn(ctx)
+}
+
+// RecordFailure counts a failed attempt and returns the number of failures in
+// the current streak. A streak ends when no failure was recorded for the
+// given window and no lock is in force.
+func (r *LoginFailureStorage) RecordFailure(ctx context.Context, scope, subject string, window time.Duration) (int, error) {
+	defer r.db.write(ctx)()
+
+	key := loginFailureKey{scope: scope, subject: subject}
+	now := time.Now().UTC()
+	next := loginFailure{failures: 1, lastFailedAt: now}
+	if current, ok := r.db.loginFailures[key]; ok {
+		next.lockedUntil = current.lockedUntil
+		if !current.lastFailedAt.Before(now.Add(-window)) || current.lockedUntil.After(now) {
+			next.failures = current.failures + 1
+		}
+	}
+	set(ctx, r.db, r.db.loginFailures, key, &next)
+
+	return next.failures, nil
+}
+
+func (r *LoginFailureStorage) Lock(ctx context.Context, scope, subject string, until time.Time) error {
+	defer r.db.write(ctx)()
+
+	key := loginFailureKey{scope: scope, subject: subject}
+	if current, ok := r.db.loginFailures[key]; ok {
+		next := *current
+		next.lockedUntil = until.UTC()
+		set(ctx, r.db, r.db.loginFailures, key, &next)
+	}
+	return nil
+}
+
+// GetLockedUntil returns the zero time when there is no lock on record.
+func (r *LoginFailureStorage) GetLockedUntil(ctx context.Context, scope, subject string) (time.Time, error) {
+	defer r.db.read(ctx)()
+
+	if current, ok := r.db.loginFailures[loginFailureKey{scope: scope, subject: subject}]; ok {
+		return current.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+// Reset forgets failures and lifts any lock.
+func (r *LoginFailureStorage) Reset(ctx context.Context, scope, subject string) error {
+	defer r.db.write(ctx)()
+
+	remove(ctx, r.db, r.db.loginFailures, loginFailureKey{scope: scope, subject: subject})
+	return nil
+}
@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/google/uuid"
+)
+
+var errDuplicateOneTimeToken = errors.New("one-time token already exists")
+
+type OneTimeTokenStorage struct {
+	db  *DB
+	ctx context.Context
+}
+
+func NewOneTimeTokenStorage(ctx context.Context, db *DB) *OneTimeTokenStorage {
+	return &OneTimeTokenStorage{ctx: ctx, db: db}
+}
+
+func cloneOneTimeToken(token *models.OneTimeToken) *models.OneTimeToken {
+	c := *token
+	c.UsedAt = cloneTime(token.UsedAt)
+	return &c
+}
+
+func (r *OneTimeTokenStorage) Create(ctx context.Context, token *models.OneTimeToken) error {
+	defer r.db.write(ctx)()
+
+	if _, ok := r.db.oneTimeTokens[token.TokenHash]; ok {
+		return errDuplicateOneTimeToken
+	}
+
+	token.CreatedAt = time.Now().UTC()
+	stored := cloneOneTimeToken(token)
+	stored.ExpiresAt = token.ExpiresAt.UTC()
+	set(ctx, r.db, r.db.oneTimeTokens, stored.TokenHash, stored)
+	return nil
+}
+
+// Get returns a token that could still be consumed, without using it up.
+func (r *OneTimeTokenStorage) Get(ctx context.Context, hash, purpose string) (*models.OneTimeToken, error) {
+	defer r.db.read(ctx)()
+
+	token, ok := r.db.oneTimeTokens[hash]
+	if !ok || !usable(token, purpose, time.Now()) {
+		return nil, storage.ErrTokenNotFound
+	}
+	return cloneOneTimeToken(token), nil
+}
+
+// Consume marks a valid token as used and returns it. Expired, already used
+// and unknown tokens all yield ErrTokenNotFound.
+func (r *OneTimeTokenStorage) Consume(ctx context.Context, hash, purpose string) (*models.OneTimeToken, error) {
+	defer r.db.write(ctx)()
+
+	now := time.Now().UTC()
+	current, ok := r.db.oneTimeTokens[hash]
+	if !ok || !usable(current, purpose, now) {
+		return nil, storage.ErrTokenNotFound
+	}
+
+	stored := cloneOneTimeToken(current)
+	stored.UsedAt = &now
+	set(ctx, r.db, r.db.oneTimeTokens, hash, stored)
+	return cloneOneTimeToken(stored), nil
+}
+
+// InvalidateForUser marks every outstanding token of the user with the given
+// purpose as used.
+func (r *OneTimeTokenStorage) InvalidateForUser(ctx context.Context, userUUID uuid.UUID, purpose string) error {
+	defer r.db.write(ctx)()
+
+	now := time.Now().UTC()
+	for hash, current := range r.db.oneTimeTokens {
+		if current.UserUUID != userUUID || current.Purpose != purpose || current.UsedAt != nil {
+			continue
+		}
+		stored := cloneOneTimeToken(current)
+		stored.UsedAt = &now
+		set(ctx, r.db, r.db.oneTimeTokens, hash, stored)
+	}
+	return nil
+}
+
+func usable(token *models.OneTimeToken, purpose string, now time.Time) bool {
+	return token.Purpose == purpose && token.UsedAt == nil && token.ExpiresAt.After(now)
+}
+
+// DeleteExpired removes one-time tokens that expired before the given moment.
+func (r *OneTimeTokenStorage) DeleteExpired(ctx context.Context, before time.Time) error {
+	defer r.db.write(ctx)()
+
+	for hash, token := range r.db.oneTimeTokens {
+		if token.ExpiresAt.Before(before) {
+			remove(ctx, r.db, r.db.oneTimeTokens, hash)
+		}
+	}
+	return nil
+}
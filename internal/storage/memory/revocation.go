@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type revokedToken struct {
+	userUUID  uuid.UUID
+	expiresAt time.Time
+}
+
+type RevocationStorage struct {
+	db  *DB
+	ctx context.Context
+}
+
+func NewRevocationStorage(ctx context.Context, db *DB) *RevocationStorage {
+	return &RevocationStorage{ctx: ctx, db: db}
+}
+
+func (r *RevocationStorage) RevokeToken(ctx context.Context, jti string, userUUID uuid.UUID, expiresAt time.Time) error {
+	defer r.db.write(ctx)()
+
+	if _, ok := r.db.revokedTokens[jti]; !ok {
+		set(ctx, r.db, r.db.revokedTokens, jti, revokedToken{userUUID: userUUID, expiresAt: expiresAt.UTC()})
+	}
+	return nil
+}
+
+func (r *RevocationStorage) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	defer r.db.read(ctx)()
+
+	_, ok := r.db.revokedTokens[jti]
+	return ok, nil
+}
+
+// RevokeAllForUser invalidates every access token of the user issued before
+// the given moment.
+func (r *RevocationStorage) RevokeAllForUser(ctx context.Context, userUUID uuid.UUID, before time.Time) error {
+	defer r.db.write(ctx)()
+
+	if current, ok := r.db.revokedBefore[userUUID]; !ok || before.After(current) {
+		set(ctx, r.db, r.db.revokedBefore, userUUID, before.UTC())
+	}
+	return nil
+}
+
+// GetRevokedBefore returns the zero time when the user never revoked their
+// tokens.
+func (r *RevocationStorage) GetRevokedBefore(ctx context.Context, userUUID uuid.UUID) (time.Time, error) {
+	defer r.db.read(ctx)()
+
+	return r.db.revokedBefore[userUUID], nil
+}
+
+// DeleteExpired removes revoked tokens that expired before the given moment.
+func (r *RevocationStorage) DeleteExpired(ctx context.Context, before time.Time) error {
+	defer r.db.write(ctx)()
+
+	for jti, token := range r.db.revokedTokens {
+		if token.expiresAt.Before(before) {
+			remove(ctx, r.db, r.db.revokedTokens, jti)
+		}
+	}
+	return nil
+}
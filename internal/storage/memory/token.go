@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/google/uuid"
+)
+
+var errDuplicateTokenHash = errors.New("refresh token hash already exists")
+
+type TokenStorage struct {
+	db  *DB
+	ctx context.Context
+}
+
+func NewTokenStorage(ctx context.Context, db *DB) *TokenStorage {
+	return &TokenStorage{ctx: ctx, db: db}
+}
+
+func cloneRefreshToken(token *models.RefreshToken) *models.RefreshToken {
+	c := *token
+	c.RotatedAt = cloneTime(token.RotatedAt)
+	c.RevokedAt = cloneTime(token.RevokedAt)
+	return &c
+}
+
+func (r *TokenStorage) Create(ctx context.Context, token *models.RefreshToken) error {
+	defer r.db.write(ctx)()
+
+	for _, other := range r.db.refreshTokens {
+		if other.TokenHash == token.TokenHash {
+			return errDuplicateTokenHash
+		}
+	}
+
+	token.UUID = uuid.New()
+	token.CreatedAt = time.Now().UTC()
+	stored := cloneRefreshToken(token)
+	stored.ExpiresAt = token.ExpiresAt.UTC()
+	set(ctx, r.db, r.db.refreshTokens, stored.UUID, stored)
+	return nil
+}
+
+func (r *TokenStorage) GetByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	defer r.db.read(ctx)()
+
+	for _, token := range r.db.refreshTokens {
+		if token.TokenHash == hash {
+			return cloneRefreshToken(token), nil
+		}
+	}
+	return nil, storage.ErrTokenNotFound
+}
+
+func (r *TokenStorage) MarkRotated(ctx context.Context, tokenUUID uuid.UUID) (bool, error) {
+	defer r.db.write(ctx)()
+
+	current, ok := r.db.refreshTokens[tokenUUID]
+	if !ok || current.RotatedAt != nil || current.RevokedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	stored := cloneRefreshToken(current)
+	stored.RotatedAt = &now
+	set(ctx, r.db, r.db.refreshTokens, tokenUUID, stored)
+	return true, nil
+}
+
+func (r *TokenStorage) RevokeFamily(ctx context.Context, familyUUID uuid.UUID) error {
+	r.revokeWhere(ctx, func(token *models.RefreshToken) bool { return token.FamilyUUID == familyUUID })
+	return nil
+}
+
+func (r *TokenStorage) RevokeAllForUser(ctx context.Context, userUUID uuid.UUID) error {
+	r.revokeWhere(ctx, func(token *models.RefreshToken) bool { return token.UserUUID == userUUID })
+	return nil
+}
+
+func (r *TokenStorage) revokeWhere(ctx context.Context, match func(*models.RefreshToken) bool) {
+	defer r.db.write(ctx)()
+
+	now := time.Now().UTC()
+	for id, current := range r.db.refreshTokens {
+		if current.RevokedAt != nil || !match(current) {
+			continue
+		}
+		stored := cloneRefreshToken(current)
+		stored.RevokedAt = &now
+		set(ctx, r.db, r.db.refreshTokens, id, stored)
+	}
+}
+
+// DeleteExpired removes refresh tokens that expired before the given moment.
+func (r *TokenStorage) DeleteExpired(ctx context.Context, before time.Time) error {
+	defer r.db.write(ctx)()
+
+	for id, token := range r.db.refreshTokens {
+		if token.ExpiresAt.Before(before) {
+			remove(ctx, r.db, r.db.refreshTokens, id)
+		}
+	}
+	return nil
+}
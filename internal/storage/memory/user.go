@@ -0,0 +1,387 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/google/uuid"
+)
+
+type UserStorage struct {
+	db  *DB
+	ctx context.Context
+}
+
+func NewUserStorage(ctx context.Context, db *DB) *UserStorage {
+	return &UserStorage{ctx: ctx, db: db}
+}
+
+// WithTx runs fn in a transaction; see DB.WithTx.
+func (r *UserStorage) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.db.WithTx(ctx, fn)
+}
+
+func cloneUser(user *models.User) *models.User {
+	c := *user
+	c.EmailVerifiedAt = cloneTime(user.EmailVerifiedAt)
+	c.TOTPEnabledAt = cloneTime(user.TOTPEnabledAt)
+	c.SuspendedAt = cloneTime(user.SuspendedAt)
+	c.PasswordChangedAt = cloneTime(user.PasswordChangedAt)
+	return &c
+}
+
+// checkUnique mirrors the case-insensitive unique indexes on users.username
+// and users.email. The user with the given UUID is not compared with itself.
+func (r *UserStorage) checkUnique(self uuid.UUID, username, email string) error {
+	for _, other := range r.db.users {
+		if other.UUID == self {
+			continue
+		}
+		if sameFold(other.Username, username) {
+			return storage.ErrUsernameTaken
+		}
+		if sameFold(other.Email, email) {
+			return storage.ErrEmailTaken
+		}
+	}
+	return nil
+}
+
+func (r *UserStorage) Create(ctx context.Context, user *models.User) error {
+	defer r.db.write(ctx)()
+
+	if err := r.checkUnique(uuid.Nil, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.UUID = uuid.New()
+	stored := &models.User{
+		UUID:         user.UUID,
+		Username:     user.Username,
+		Email:        user.Email,
+		PasswordHash: user.PasswordHash,
+		Role:         user.Role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	set(ctx, r.db, r.db.users, stored.UUID, stored)
+
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return nil
+}
+
+func (r *UserStorage) GetByUUID(ctx context.Context, uuid uuid.UUID) (*models.User, error) {
+	defer r.db.read(ctx)()
+
+	user, ok := r.db.users[uuid]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+	return cloneUser(user), nil
+}
+
+func (r *UserStorage) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.find(ctx, func(user *models.User) bool { return sameFold(user.Email, email) })
+}
+
+func (r *UserStorage) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.find(ctx, func(user *models.User) bool { return sameFold(user.Username, username) })
+}
+
+// sameFold compares like lower(a) = lower(b) in SQL.
+func sameFold(a, b string) bool {
+	return strings.ToLower(a) == strings.ToLower(b)
+}
+
+func (r *UserStorage) find(ctx context.Context, match func(*models.User) bool) (*models.User, error) {
+	defer r.db.read(ctx)()
+
+	for _, user := range r.db.users {
+		if match(user) {
+			return cloneUser(user), nil
+		}
+	}
+	return nil, storage.ErrUserNotFound
+}
+
+func (r *UserStorage) Update(ctx context.Context, user *models.User) error {
+	return r.update(ctx, user.UUID, func(stored *models.User) error {
+		if err := r.checkUnique(user.UUID, user.Username, user.Email); err != nil {
+			return err
+		}
+		stored.Username = user.Username
+		stored.Email = user.Email
+		stored.PasswordHash = user.PasswordHash
+		stored.Role = user.Role
+		stored.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (r *UserStorage) UpdateRole(ctx context.Context, uuid uuid.UUID, role string) error {
+	return r.update(ctx, uuid, func(stored *models.User) error {
+		stored.Role = role
+		stored.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// UpdateSuspension suspends the user when suspendedAt is set and lifts the
+// suspension when it is nil.
+func (r *UserStorage) UpdateSuspension(ctx context.Context, uuid uuid.UUID, suspendedAt *time.Time) error {
+	return r.update(ctx, uuid, func(stored *models.User) error {
+		stored.SuspendedAt = cloneTime(suspendedAt)
+		stored.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (r *UserStorage) UpdatePasswordResetRequired(ctx context.Context, uuid uuid.UUID, required bool) error {
+	return r.update(ctx, uuid, func(stored *models.User) error {
+		stored.PasswordResetRequired = required
+		stored.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// UpdatePendingEmail stores an address the user wants to switch to until it
+// is verified. An empty email clears it.
+func (r *UserStorage) UpdatePendingEmail(ctx context.Context, uuid uuid.UUID, email string) error {
+	return r.update(ctx, uuid, func(stored *models.User) error {
+		stored.PendingEmail = email
+		stored.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// MarkEmailVerified confirms the given address. When it is the pending one,
+// it replaces the current email.
+func (r *UserStorage) MarkEmailVerified(ctx context.Context, uuid uuid.UUID, email string) error {
+	return r.update(ctx, uuid, func(stored *models.User) error {
+		if stored.Email != email && stored.PendingEmail != email {
+			return storage.ErrUserNotFound
+		}
+		if err := r.checkUnique(uuid, stored.Username, email); err != nil {
+			return err
+		}
+		now := time.Now()
+		stored.Email = email
+		stored.EmailVerifiedAt = &now
+		stored.PendingEmail = ""
+		stored.UpdatedAt = now
+		return nil
+	})
+}
+
+// UpdateTOTP stores the user's TOTP secret; enabledAt is nil until the user
+// confirms enrollment. An empty secret disables two-factor authentication.
+func (r *UserStorage) UpdateTOTP(ctx context.Context, uuid uuid.UUID, secret string, enabledAt *time.Time) error {
+	return r.update(ctx, uuid, func(stored *models.User) error {
+		stored.TOTPSecret = secret
+		stored.TOTPEnabledAt = cloneTime(enabledAt)
+		stored.TOTPLastStep = 0
+		stored.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// UseTOTPStep records the time step of an accepted code. It reports false if
+// that step, or a later one, was already used, which stops code replay.
+func (r *UserStorage) UseTOTPStep(ctx context.Context, uuid uuid.UUID, step int64) (bool, error) {
+	defer r.db.write(ctx)()
+
+	current, ok := r.db.users[uuid]
+	if !ok || current.TOTPLastStep >= step {
+		return false, nil
+	}
+
+	stored := cloneUser(current)
+	stored.TOTPLastStep = step
+	set(ctx, r.db, r.db.users, uuid, stored)
+	return true, nil
+}
+
+// UpdatePassword stores a new password hash. A new password also satisfies a
+// pending forced reset.
+func (r *UserStorage) UpdatePassword(ctx context.Context, uuid uuid.UUID, hash string, changedAt time.Time) error {
+	return r.update(ctx, uuid, func(stored *models.User) error {
+		changedAt := changedAt.UTC()
+		stored.PasswordHash = hash
+		stored.PasswordChangedAt = &changedAt
+		stored.PasswordResetRequired = false
+		stored.UpdatedAt = changedAt
+		return nil
+	})
+}
+
+// RehashPassword swaps in a new hash of the same password. It only applies
+// while the stored hash is still oldHash, so it cannot undo a password change
+// that happened in the meantime.
+func (r *UserStorage) RehashPassword(ctx context.Context, uuid uuid.UUID, oldHash, newHash string) error {
+	return r.update(ctx, uuid, func(stored *models.User) error {
+		if stored.PasswordHash != oldHash {
+			return storage.ErrUserNotFound
+		}
+		stored.PasswordHash = newHash
+		return nil
+	})
+}
+
+// update applies change to a copy of the stored user and saves the copy
+// unless change fails. A missing user yields storage.ErrUserNotFound.
+func (r *UserStorage) update(ctx context.Context, uuid uuid.UUID, change func(stored *models.User) error) error {
+	defer r.db.write(ctx)()
+
+	current, ok := r.db.users[uuid]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+
+	stored := cloneUser(current)
+	if err := change(stored); err != nil {
+		return err
+	}
+	set(ctx, r.db, r.db.users, uuid, stored)
+	return nil
+}
+
+// Delete removes the user along with their tokens, as the foreign keys in
+// Postgres do.
+func (r *UserStorage) Delete(ctx context.Context, uuid uuid.UUID) error {
+	defer r.db.write(ctx)()
+
+	if _, ok := r.db.users[uuid]; !ok {
+		return storage.ErrUserNotFound
+	}
+	remove(ctx, r.db, r.db.users, uuid)
+
+	for id, token := range r.db.refreshTokens {
+		if token.UserUUID == uuid {
+			remove(ctx, r.db, r.db.refreshTokens, id)
+		}
+	}
+	for hash, token := range r.db.oneTimeTokens {
+		if token.UserUUID == uuid {
+			remove(ctx, r.db, r.db.oneTimeTokens, hash)
+		}
+	}
+	for jti, token := range r.db.revokedTokens {
+		if token.userUUID == uuid {
+			remove(ctx, r.db, r.db.revokedTokens, jti)
+		}
+	}
+	remove(ctx, r.db, r.db.revokedBefore, uuid)
+
+	return nil
+}
+
+func (r *UserStorage) List(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	defer r.db.read(ctx)()
+
+	compare := userComparator(filter.Sort)
+	users := []models.User{}
+	for _, user := range r.db.users {
+		if !matchesFilter(user, filter) {
+			continue
+		}
+		if filter.After != nil && compare(user, cursorUser(filter.After)) <= 0 {
+			continue
+		}
+		users = append(users, *cloneUser(user))
+	}
+
+	slices.SortFunc(users, func(a, b models.User) int { return compare(&a, &b) })
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+// Count returns the number of users matching the filter, ignoring paging.
+func (r *UserStorage) Count(ctx context.Context, filter models.UserFilter) (int, error) {
+	defer r.db.read(ctx)()
+
+	count := 0
+	for _, user := range r.db.users {
+		if matchesFilter(user, filter) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func matchesFilter(user *models.User, filter models.UserFilter) bool {
+	if filter.Role != "" && user.Role != filter.Role {
+		return false
+	}
+	switch filter.Status {
+	case models.UserStatusActive:
+		if user.IsSuspended() {
+			return false
+		}
+	case models.UserStatusSuspended:
+		if !user.IsSuspended() {
+			return false
+		}
+	}
+	if filter.CreatedAfter != nil && !user.CreatedAt.After(*filter.CreatedAfter) {
+		return false
+	}
+	if filter.CreatedBefore != nil && !user.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+	if filter.UsernamePrefix != "" && !hasPrefixFold(user.Username, filter.UsernamePrefix) {
+		return false
+	}
+	if filter.EmailPrefix != "" && !hasPrefixFold(user.Email, filter.EmailPrefix) {
+		return false
+	}
+	if filter.Query != "" && !containsFold(user.Username, filter.Query) && !containsFold(user.Email, filter.Query) {
+		return false
+	}
+	return true
+}
+
+// hasPrefixFold and containsFold match like ILIKE does.
+func hasPrefixFold(s, prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(s), strings.ToLower(prefix))
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// userComparator orders users like userOrderBy in the Postgres storage, with
+// the UUID breaking ties.
+func userComparator(sort string) func(a, b *models.User) int {
+	byKey := func(a, b *models.User) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if strings.TrimPrefix(sort, "-") == models.SortUsernameAsc {
+		byKey = func(a, b *models.User) int {
+			return strings.Compare(a.Username, b.Username)
+		}
+	}
+
+	compare := func(a, b *models.User) int {
+		if c := byKey(a, b); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.UUID[:], b.UUID[:])
+	}
+	if strings.HasPrefix(sort, "-") {
+		return func(a, b *models.User) int { return compare(b, a) }
+	}
+	return compare
+}
+
+func cursorUser(cursor *models.UserCursor) *models.User {
+	return &models.User{UUID: cursor.UUID, Username: cursor.Username, CreatedAt: cursor.CreatedAt}
+}
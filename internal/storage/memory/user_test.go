@@ -0,0 +1,16 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Gezubov/user_service/internal/service"
+	"github.com/Gezubov/user_service/internal/storage/memory"
+	"github.com/Gezubov/user_service/internal/storage/storagetest"
+)
+
+func TestUserStorage(t *testing.T) {
+	storagetest.RunUserStorageTests(t, func(t *testing.T) service.UserStorage {
+		return memory.NewUserStorage(context.Background(), memory.New())
+	})
+}
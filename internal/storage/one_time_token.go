@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type OneTimeTokenStorage struct {
+	db  *pgxpool.Pool
+	ctx context.Context
+}
+
+func NewOneTimeTokenStorage(ctx context.Context, db *pgxpool.Pool) *OneTimeTokenStorage {
+	return &OneTimeTokenStorage{ctx: ctx, db: db}
+}
+
+func (r *OneTimeTokenStorage) Create(ctx context.Context, token *models.OneTimeToken) error {
+	slog.Info("Creating one-time token", "user_uuid", token.UserUUID, "purpose", token.Purpose)
+	query := `
+		INSERT INTO one_time_tokens (token_hash, user_uuid, purpose, email, expires_at, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)`
+
+	token.CreatedAt = time.Now().UTC()
+	_, err := conn(ctx, r.db).Exec(ctx,
+		query,
+		token.TokenHash,
+		token.UserUUID,
+		token.Purpose,
+		token.Email,
+		token.ExpiresAt.UTC(),
+		token.CreatedAt,
+	)
+	if err != nil {
+		slog.Error("Error creating one-time token", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Get returns a token that could still be consumed, without using it up.
+func (r *OneTimeTokenStorage) Get(ctx context.Context, hash, purpose string) (*models.OneTimeToken, error) {
+	token := &models.OneTimeToken{}
+
+	query := `
+		SELECT token_hash, user_uuid, purpose, COALESCE(email, ''), expires_at, used_at, created_at
+		FROM one_time_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3`
+
+	err := conn(ctx, r.db).QueryRow(ctx, query, hash, purpose, time.Now().UTC()).Scan(
+		&token.TokenHash,
+		&token.UserUUID,
+		&token.Purpose,
+		&token.Email,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		slog.Error("Error fetching one-time token", "purpose", purpose, "error", err)
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Consume marks a valid token as used and returns it. Expired, already used
+// and unknown tokens all yield ErrTokenNotFound.
+func (r *OneTimeTokenStorage) Consume(ctx context.Context, hash, purpose string) (*models.OneTimeToken, error) {
+	token := &models.OneTimeToken{}
+
+	query := `
+		UPDATE one_time_tokens
+		SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING token_hash, user_uuid, purpose, COALESCE(email, ''), expires_at, used_at, created_at`
+
+	err := conn(ctx, r.db).QueryRow(ctx, query, time.Now().UTC(), hash, purpose).Scan(
+		&token.TokenHash,
+		&token.UserUUID,
+		&token.Purpose,
+		&token.Email,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		slog.Error("Error consuming one-time token", "purpose", purpose, "error", err)
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// InvalidateForUser marks every outstanding token of the user with the given
+// purpose as used.
+func (r *OneTimeTokenStorage) InvalidateForUser(ctx context.Context, userUUID uuid.UUID, purpose string) error {
+	query := `
+		UPDATE one_time_tokens
+		SET used_at = $1
+		WHERE user_uuid = $2 AND purpose = $3 AND used_at IS NULL`
+
+	_, err := conn(ctx, r.db).Exec(ctx, query, time.Now().UTC(), userUUID, purpose)
+	if err != nil {
+		slog.Error("Error invalidating one-time tokens", "user_uuid", userUUID, "purpose", purpose, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpired removes one-time tokens that expired before the given moment.
+func (r *OneTimeTokenStorage) DeleteExpired(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM one_time_tokens WHERE expires_at < $1`
+
+	if _, err := conn(ctx, r.db).Exec(ctx, query, before.UTC()); err != nil {
+		slog.Error("Error deleting expired one-time tokens", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// RateLimitStorage keeps token buckets in Postgres so that every instance of
+// the service draws from the same budget.
+type RateLimitStorage struct {
+	db  *pgxpool.Pool
+	ctx context.Context
+}
+
+func NewRateLimitStorage(ctx context.Context, db *pgxpool.Pool) *RateLimitStorage {
+	return &RateLimitStorage{ctx: ctx, db: db}
+}
+
+// Take refills the bucket and takes a token in a single statement, so
+// concurrent requests cannot both spend the last one.
+func (r *RateLimitStorage) Take(ctx context.Context, key string, limit int, period time.Duration) (float64, bool, error) {
+	query := `
+		INSERT INTO rate_limit_buckets AS b (bucket_key, tokens, allowed, updated_at)
+		VALUES ($1, $2::float8 - 1, TRUE, $4)
+		ON CONFLICT (bucket_key) DO UPDATE
+		SET allowed = LEAST($2::float8,
+				b.tokens + GREATEST(EXTRACT(EPOCH FROM ($4 - b.updated_at))::float8, 0) * $3::float8) >= 1,
+			tokens = LEAST($2::float8,
+				b.tokens + GREATEST(EXTRACT(EPOCH FROM ($4 - b.updated_at))::float8, 0) * $3::float8)
+				- CASE WHEN LEAST($2::float8,
+					b.tokens + GREATEST(EXTRACT(EPOCH FROM ($4 - b.updated_at))::float8, 0) * $3::float8) >= 1
+				THEN 1 ELSE 0 END,
+			updated_at = $4
+		RETURNING tokens, allowed`
+
+	ratePerSecond := float64(limit) / period.Seconds()
+
+	var tokens float64
+	var allowed bool
+	err := conn(ctx, r.db).QueryRow(ctx, query, key, float64(limit), ratePerSecond, time.Now().UTC()).Scan(&tokens, &allowed)
+	if err != nil {
+		slog.Error("Error taking rate limit token", "key", key, "error", err)
+		return 0, false, err
+	}
+
+	return tokens, allowed, nil
+}
+
+// DeleteIdle removes buckets untouched since before; by then they have
+// refilled and are equivalent to a missing row.
+func (r *RateLimitStorage) DeleteIdle(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM rate_limit_buckets WHERE updated_at < $1`
+
+	if _, err := conn(ctx, r.db).Exec(ctx, query, before.UTC()); err != nil {
+		slog.Error("Error deleting idle rate limit buckets", "error", err)
+		return err
+	}
+
+	return nil
+}
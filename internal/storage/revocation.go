@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type RevocationStorage struct {
+	db  *pgxpool.Pool
+	ctx context.Context
+}
+
+func NewRevocationStorage(ctx context.Context, db *pgxpool.Pool) *RevocationStorage {
+	return &RevocationStorage{ctx: ctx, db: db}
+}
+
+func (r *RevocationStorage) RevokeToken(ctx context.Context, jti string, userUUID uuid.UUID, expiresAt time.Time) error {
+	slog.Info("Revoking access token", "jti", jti, "user_uuid", userUUID)
+	query := `
+		INSERT INTO revoked_tokens (jti, user_uuid, expires_at, revoked_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING`
+
+	_, err := conn(ctx, r.db).Exec(ctx, query, jti, userUUID, expiresAt.UTC(), time.Now().UTC())
+	if err != nil {
+		slog.Error("Error revoking access token", "jti", jti, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *RevocationStorage) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+
+	var revoked bool
+	if err := conn(ctx, r.db).QueryRow(ctx, query, jti).Scan(&revoked); err != nil {
+		slog.Error("Error checking token revocation", "jti", jti, "error", err)
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// RevokeAllForUser invalidates every access token of the user issued before
+// the given moment.
+func (r *RevocationStorage) RevokeAllForUser(ctx context.Context, userUUID uuid.UUID, before time.Time) error {
+	slog.Info("Revoking all access tokens of user", "user_uuid", userUUID)
+	query := `
+		INSERT INTO user_token_revocations (user_uuid, revoked_before)
+		VALUES ($1, $2)
+		ON CONFLICT (user_uuid) DO UPDATE
+		SET revoked_before = GREATEST(user_token_revocations.revoked_before, EXCLUDED.revoked_before)`
+
+	_, err := conn(ctx, r.db).Exec(ctx, query, userUUID, before.UTC())
+	if err != nil {
+		slog.Error("Error revoking user tokens", "user_uuid", userUUID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetRevokedBefore returns the zero time when the user never revoked their
+// tokens.
+func (r *RevocationStorage) GetRevokedBefore(ctx context.Context, userUUID uuid.UUID) (time.Time, error) {
+	query := `SELECT revoked_before FROM user_token_revocations WHERE user_uuid = $1`
+
+	var before time.Time
+	err := conn(ctx, r.db).QueryRow(ctx, query, userUUID).Scan(&before)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		slog.Error("Error fetching user token revocation", "user_uuid", userUUID, "error", err)
+		return time.Time{}, err
+	}
+
+	return before, nil
+}
+
+// DeleteExpired removes revoked tokens that expired before the given moment.
+func (r *RevocationStorage) DeleteExpired(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM revoked_tokens WHERE expires_at < $1`
+
+	if _, err := conn(ctx, r.db).Exec(ctx, query, before.UTC()); err != nil {
+		slog.Error("Error deleting expired revoked tokens", "error", err)
+		return err
+	}
+
+	return nil
+}
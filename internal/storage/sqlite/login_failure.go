@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/storage"
+)
+
+type LoginFailureStorage struct {
+	db  *sql.DB
+	ctx context.Context
+	// locks serializes login attempts per counter. A SQLite file is served
+	// by a single instance, so locking within the process is enough.
+	locks storage.KeyLocks
+}
+
+func NewLoginFailureStorage(ctx context.Context, db *sql.DB) *LoginFailureStorage {
+	return &LoginFailureStorage{ctx: ctx, db: db}
+}
+
+// WithLock runs fn while no other WithLock call of this storage for the same
+// scope and subject runs. It does not hold a transaction, which would block
+// the single connection for as long as fn takes.
+func (r *LoginFailureStorage) WithLock(ctx context.Context, scope, subject string, fn func(ctx context.Context) error) error {
+	defer r.locks.Lock(scope + ":" + subject)()
+	return fn(ctx)
+}
+
+// RecordFailure counts a failed attempt and returns the number of failures in
+// the current streak. A streak ends when no failure was recorded for the
+// given window and no lock is in force.
+func (r *LoginFailureStorage) RecordFailure(ctx context.Context, scope, subject string, window time.Duration) (int, error) {
+	query := `
+		INSERT INTO login_failures (scope, subject, failures, last_failed_at)
+		VALUES (?1, ?2, 1, ?3)
+		ON CONFLICT (scope, subject) DO UPDATE
+		SET failures = CASE
+				WHEN login_failures.last_failed_at < ?4
+					AND COALESCE(login_failures.locked_until, ?3) <= ?3 THEN 1
+				ELSE login_failures.failures + 1
+			END,
+			last_failed_at = excluded.last_failed_at
+		RETURNING failures`
+
+	now := time.Now()
+	var failures int
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, scope, subject, timeValue(now), timeValue(now.Add(-window))).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (r *LoginFailureStorage) Lock(ctx context.Context, scope, subject string, until time.Time) error {
+	query := `UPDATE login_failures SET locked_until = ?3 WHERE scope = ?1 AND subject = ?2`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, scope, subject, timeValue(until))
+	return err
+}
+
+// GetLockedUntil returns the zero time when there is no lock on record.
+func (r *LoginFailureStorage) GetLockedUntil(ctx context.Context, scope, subject string) (time.Time, error) {
+	query := `SELECT locked_until FROM login_failures WHERE scope = ?1 AND subject = ?2`
+
+	var lockedUntil *time.Time
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, scope, subject).Scan(nullTimeColumn{&lockedUntil})
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && lockedUntil == nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return *lockedUntil, nil
+}
+
+// Reset forgets failures and lifts any lock.
+func (r *LoginFailureStorage) Reset(ctx context.Context, scope, subject string) error {
+	query := `DELETE FROM login_failures WHERE scope = ?1 AND subject = ?2`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, scope, subject)
+	return err
+}
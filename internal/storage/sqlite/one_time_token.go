@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/google/uuid"
+)
+
+const oneTimeTokenColumns = `token_hash, user_uuid, purpose, COALESCE(email, ''), expires_at, used_at, created_at`
+
+type OneTimeTokenStorage struct {
+	db  *sql.DB
+	ctx context.Context
+}
+
+func NewOneTimeTokenStorage(ctx context.Context, db *sql.DB) *OneTimeTokenStorage {
+	return &OneTimeTokenStorage{ctx: ctx, db: db}
+}
+
+func scanOneTimeToken(row row) (*models.OneTimeToken, error) {
+	token := &models.OneTimeToken{}
+	err := row.Scan(
+		&token.TokenHash,
+		&token.UserUUID,
+		&token.Purpose,
+		&token.Email,
+		timeColumn{&token.ExpiresAt},
+		nullTimeColumn{&token.UsedAt},
+		timeColumn{&token.CreatedAt},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *OneTimeTokenStorage) Create(ctx context.Context, token *models.OneTimeToken) error {
+	query := `
+		INSERT INTO one_time_tokens (token_hash, user_uuid, purpose, email, expires_at, created_at)
+		VALUES (?1, ?2, ?3, NULLIF(?4, ''), ?5, ?6)`
+
+	token.CreatedAt = time.Now().UTC()
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		query,
+		token.TokenHash,
+		token.UserUUID,
+		token.Purpose,
+		token.Email,
+		timeValue(token.ExpiresAt),
+		timeValue(token.CreatedAt),
+	)
+	if err != nil {
+		slog.Error("Error creating one-time token", "user_uuid", token.UserUUID, "purpose", token.Purpose, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Get returns a token that could still be consumed, without using it up.
+func (r *OneTimeTokenStorage) Get(ctx context.Context, hash, purpose string) (*models.OneTimeToken, error) {
+	query := `
+		SELECT ` + oneTimeTokenColumns + `
+		FROM one_time_tokens
+		WHERE token_hash = ?1 AND purpose = ?2 AND used_at IS NULL AND expires_at > ?3`
+
+	return scanOneTimeToken(conn(ctx, r.db).QueryRowContext(ctx, query, hash, purpose, timeValue(time.Now())))
+}
+
+// Consume marks a valid token as used and returns it. Expired, already used
+// and unknown tokens all yield ErrTokenNotFound.
+func (r *OneTimeTokenStorage) Consume(ctx context.Context, hash, purpose string) (*models.OneTimeToken, error) {
+	query := `
+		UPDATE one_time_tokens
+		SET used_at = ?1
+		WHERE token_hash = ?2 AND purpose = ?3 AND used_at IS NULL AND expires_at > ?1
+		RETURNING ` + oneTimeTokenColumns
+
+	return scanOneTimeToken(conn(ctx, r.db).QueryRowContext(ctx, query, timeValue(time.Now()), hash, purpose))
+}
+
+// InvalidateForUser marks every outstanding token of the user with the given
+// purpose as used.
+func (r *OneTimeTokenStorage) InvalidateForUser(ctx context.Context, userUUID uuid.UUID, purpose string) error {
+	query := `
+		UPDATE one_time_tokens
+		SET used_at = ?1
+		WHERE user_uuid = ?2 AND purpose = ?3 AND used_at IS NULL`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, timeValue(time.Now()), userUUID, purpose)
+	if err != nil {
+		slog.Error("Error invalidating one-time tokens", "user_uuid", userUUID, "purpose", purpose, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpired removes one-time tokens that expired before the given moment.
+func (r *OneTimeTokenStorage) DeleteExpired(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM one_time_tokens WHERE expires_at < ?1`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, timeValue(before)); err != nil {
+		slog.Error("Error deleting expired one-time tokens", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RevocationStorage struct {
+	db  *sql.DB
+	ctx context.Context
+}
+
+func NewRevocationStorage(ctx context.Context, db *sql.DB) *RevocationStorage {
+	return &RevocationStorage{ctx: ctx, db: db}
+}
+
+func (r *RevocationStorage) RevokeToken(ctx context.Context, jti string, userUUID uuid.UUID, expiresAt time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_uuid, expires_at, revoked_at)
+		VALUES (?1, ?2, ?3, ?4)
+		ON CONFLICT (jti) DO NOTHING`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, jti, userUUID, timeValue(expiresAt), timeValue(time.Now()))
+	return err
+}
+
+func (r *RevocationStorage) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?1)`
+
+	var revoked bool
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, jti).Scan(&revoked); err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// RevokeAllForUser invalidates every access token of the user issued before
+// the given moment.
+func (r *RevocationStorage) RevokeAllForUser(ctx context.Context, userUUID uuid.UUID, before time.Time) error {
+	query := `
+		INSERT INTO user_token_revocations (user_uuid, revoked_before)
+		VALUES (?1, ?2)
+		ON CONFLICT (user_uuid) DO UPDATE
+		SET revoked_before = MAX(user_token_revocations.revoked_before, excluded.revoked_before)`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userUUID, timeValue(before))
+	return err
+}
+
+// GetRevokedBefore returns the zero time when the user never revoked their
+// tokens.
+func (r *RevocationStorage) GetRevokedBefore(ctx context.Context, userUUID uuid.UUID) (time.Time, error) {
+	query := `SELECT revoked_before FROM user_token_revocations WHERE user_uuid = ?1`
+
+	var before time.Time
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userUUID).Scan(timeColumn{&before})
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return before, nil
+}
+
+// DeleteExpired removes revoked tokens that expired before the given moment.
+func (r *RevocationStorage) DeleteExpired(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM revoked_tokens WHERE expires_at < ?1`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, timeValue(before)); err != nil {
+		slog.Error("Error deleting expired revoked tokens", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/google/uuid"
+)
+
+type TokenStorage struct {
+	db  *sql.DB
+	ctx context.Context
+}
+
+func NewTokenStorage(ctx context.Context, db *sql.DB) *TokenStorage {
+	return &TokenStorage{ctx: ctx, db: db}
+}
+
+func (r *TokenStorage) Create(ctx context.Context, token *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (uuid, user_uuid, family_uuid, token_hash, expires_at, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6)`
+
+	token.UUID = uuid.New()
+	token.CreatedAt = time.Now().UTC()
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		query,
+		token.UUID,
+		token.UserUUID,
+		token.FamilyUUID,
+		token.TokenHash,
+		timeValue(token.ExpiresAt),
+		timeValue(token.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *TokenStorage) GetByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+
+	query := `
+		SELECT uuid, user_uuid, family_uuid, token_hash, expires_at, rotated_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = ?1`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, hash).Scan(
+		&token.UUID,
+		&token.UserUUID,
+		&token.FamilyUUID,
+		&token.TokenHash,
+		timeColumn{&token.ExpiresAt},
+		nullTimeColumn{&token.RotatedAt},
+		nullTimeColumn{&token.RevokedAt},
+		timeColumn{&token.CreatedAt},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (r *TokenStorage) MarkRotated(ctx context.Context, tokenUUID uuid.UUID) (bool, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET rotated_at = ?1
+		WHERE uuid = ?2 AND rotated_at IS NULL AND revoked_at IS NULL`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, timeValue(time.Now()), tokenUUID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+func (r *TokenStorage) RevokeFamily(ctx context.Context, familyUUID uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = ?1
+		WHERE family_uuid = ?2 AND revoked_at IS NULL`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, timeValue(time.Now()), familyUUID)
+	return err
+}
+
+func (r *TokenStorage) RevokeAllForUser(ctx context.Context, userUUID uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = ?1
+		WHERE user_uuid = ?2 AND revoked_at IS NULL`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, timeValue(time.Now()), userUUID)
+	return err
+}
+
+// DeleteExpired removes refresh tokens that expired before the given moment.
+func (r *TokenStorage) DeleteExpired(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM refresh_tokens WHERE expires_at < ?1`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, timeValue(before)); err != nil {
+		slog.Error("Error deleting expired refresh tokens", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+// Package sqlite implements the storages on SQLite, for small deployments
+// and local development. It mirrors the Postgres storages in package storage
+// and returns the same errors.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/storage"
+	sqlitedriver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// querier is what the storages need from a connection; both the database and
+// a transaction provide it.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+// WithTx runs fn in a transaction carried by the context it is given: every
+// storage call made with that context joins the transaction, whichever
+// storage it belongs to. The transaction commits when fn returns nil and
+// rolls back otherwise. Nested calls join the outer transaction.
+func WithTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// conn returns the transaction in ctx, if any, or else the database.
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// mapUniqueViolation turns a unique-constraint error on the users table into
+// storage.ErrUsernameTaken or storage.ErrEmailTaken. SQLite names the
+// offending columns of a constraint ("UNIQUE constraint failed: users.email")
+// but an expression index by its name ("... failed: index
+// 'users_email_lower_key'"); both contain the column name. Other errors are
+// returned unchanged.
+func mapUniqueViolation(err error) error {
+	var sqliteErr *sqlitedriver.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return err
+	}
+
+	switch {
+	case strings.Contains(sqliteErr.Error(), "username"):
+		return storage.ErrUsernameTaken
+	case strings.Contains(sqliteErr.Error(), "email"):
+		return storage.ErrEmailTaken
+	}
+	return err
+}
+
+// timeLayout is how timestamps are stored: fixed-width UTC text, so that SQL
+// comparisons and ORDER BY work on it. Precision matches Postgres.
+const timeLayout = "2006-01-02 15:04:05.000000"
+
+func timeValue(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func nullTimeValue(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return timeValue(*t)
+}
+
+// timeColumn scans a timestamp written by timeValue.
+type timeColumn struct{ dest *time.Time }
+
+func (c timeColumn) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+
+	t, err := time.Parse(timeLayout, text)
+	if err != nil {
+		return err
+	}
+	*c.dest = t
+	return nil
+}
+
+// nullTimeColumn scans a nullable timestamp written by nullTimeValue.
+type nullTimeColumn struct{ dest **time.Time }
+
+func (c nullTimeColumn) Scan(src interface{}) error {
+	if src == nil {
+		*c.dest = nil
+		return nil
+	}
+	var t time.Time
+	if err := (timeColumn{&t}).Scan(src); err != nil {
+		return err
+	}
+	*c.dest = &t
+	return nil
+}
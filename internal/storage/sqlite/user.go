@@ -0,0 +1,375 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/google/uuid"
+)
+
+const userColumns = `uuid, username, email, password_hash, role, email_verified_at, COALESCE(pending_email, ''),
+	COALESCE(totp_secret, ''), totp_enabled_at, COALESCE(totp_last_step, 0),
+	suspended_at, password_reset_required, password_changed_at, created_at, updated_at`
+
+type UserStorage struct {
+	db  *sql.DB
+	ctx context.Context
+}
+
+func NewUserStorage(ctx context.Context, db *sql.DB) *UserStorage {
+	return &UserStorage{ctx: ctx, db: db}
+}
+
+// WithTx runs fn in a transaction; see the package-level WithTx.
+func (r *UserStorage) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithTx(ctx, r.db, fn)
+}
+
+type row interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row row, user *models.User) error {
+	return row.Scan(
+		&user.UUID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		nullTimeColumn{&user.EmailVerifiedAt},
+		&user.PendingEmail,
+		&user.TOTPSecret,
+		nullTimeColumn{&user.TOTPEnabledAt},
+		&user.TOTPLastStep,
+		nullTimeColumn{&user.SuspendedAt},
+		&user.PasswordResetRequired,
+		nullTimeColumn{&user.PasswordChangedAt},
+		timeColumn{&user.CreatedAt},
+		timeColumn{&user.UpdatedAt},
+	)
+}
+
+func (r *UserStorage) Create(ctx context.Context, user *models.User) error {
+	slog.Info("Creating user", "username", user.Username)
+	query := `
+		INSERT INTO users (uuid, username, email, password_hash, role, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?6)`
+
+	now := time.Now()
+	id := uuid.New()
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		query,
+		id,
+		user.Username,
+		user.Email,
+		user.PasswordHash,
+		user.Role,
+		timeValue(now),
+	)
+	if err != nil {
+		slog.Error("Error creating user", "error", err)
+		return mapUniqueViolation(err)
+	}
+
+	user.UUID = id
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return nil
+}
+
+func (r *UserStorage) GetByUUID(ctx context.Context, uuid uuid.UUID) (*models.User, error) {
+	slog.Info("Getting user with UUID", "uuid", uuid)
+	return r.getBy(ctx, "uuid = ?1", uuid)
+}
+
+func (r *UserStorage) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	slog.Info("Getting user with email", "email", email)
+	return r.getBy(ctx, "lower(email) = lower(?1)", email)
+}
+
+func (r *UserStorage) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	slog.Info("Getting user with username", "username", username)
+	return r.getBy(ctx, "lower(username) = lower(?1)", username)
+}
+
+// getBy returns the user matching condition, which refers to value as ?1.
+func (r *UserStorage) getBy(ctx context.Context, condition string, value interface{}) (*models.User, error) {
+	user := &models.User{}
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + condition
+
+	err := scanUser(conn(ctx, r.db).QueryRowContext(ctx, query, value), user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrUserNotFound
+	}
+	if err != nil {
+		slog.Error("Error fetching user", "condition", condition, "value", value, "error", err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (r *UserStorage) Update(ctx context.Context, user *models.User) error {
+	slog.Info("Updating user", "uuid", user.UUID)
+	query := `
+		UPDATE users
+		SET username = ?1, email = ?2, password_hash = ?3, role = ?4, updated_at = ?5
+		WHERE uuid = ?6`
+
+	return r.execOnUser(ctx, user.UUID, query,
+		user.Username, user.Email, user.PasswordHash, user.Role, timeValue(time.Now()), user.UUID)
+}
+
+func (r *UserStorage) UpdateRole(ctx context.Context, uuid uuid.UUID, role string) error {
+	slog.Info("Updating user role", "uuid", uuid, "role", role)
+	query := `UPDATE users SET role = ?1, updated_at = ?2 WHERE uuid = ?3`
+
+	return r.execOnUser(ctx, uuid, query, role, timeValue(time.Now()), uuid)
+}
+
+// UpdateSuspension suspends the user when suspendedAt is set and lifts the
+// suspension when it is nil.
+func (r *UserStorage) UpdateSuspension(ctx context.Context, uuid uuid.UUID, suspendedAt *time.Time) error {
+	slog.Info("Updating user suspension", "uuid", uuid, "suspended", suspendedAt != nil)
+	query := `UPDATE users SET suspended_at = ?1, updated_at = ?2 WHERE uuid = ?3`
+
+	return r.execOnUser(ctx, uuid, query, nullTimeValue(suspendedAt), timeValue(time.Now()), uuid)
+}
+
+func (r *UserStorage) UpdatePasswordResetRequired(ctx context.Context, uuid uuid.UUID, required bool) error {
+	slog.Info("Updating user password reset flag", "uuid", uuid, "required", required)
+	query := `UPDATE users SET password_reset_required = ?1, updated_at = ?2 WHERE uuid = ?3`
+
+	return r.execOnUser(ctx, uuid, query, required, timeValue(time.Now()), uuid)
+}
+
+// UpdatePendingEmail stores an address the user wants to switch to until it
+// is verified. An empty email clears it.
+func (r *UserStorage) UpdatePendingEmail(ctx context.Context, uuid uuid.UUID, email string) error {
+	slog.Info("Updating user pending email", "uuid", uuid)
+	query := `UPDATE users SET pending_email = NULLIF(?1, ''), updated_at = ?2 WHERE uuid = ?3`
+
+	return r.execOnUser(ctx, uuid, query, email, timeValue(time.Now()), uuid)
+}
+
+// MarkEmailVerified confirms the given address. When it is the pending one,
+// it replaces the current email.
+func (r *UserStorage) MarkEmailVerified(ctx context.Context, uuid uuid.UUID, email string) error {
+	slog.Info("Marking user email verified", "uuid", uuid)
+	query := `
+		UPDATE users
+		SET email = ?1, email_verified_at = ?2, pending_email = NULL, updated_at = ?2
+		WHERE uuid = ?3 AND (email = ?1 OR pending_email = ?1)`
+
+	return r.execOnUser(ctx, uuid, query, email, timeValue(time.Now()), uuid)
+}
+
+// UpdateTOTP stores the user's TOTP secret; enabledAt is nil until the user
+// confirms enrollment. An empty secret disables two-factor authentication.
+func (r *UserStorage) UpdateTOTP(ctx context.Context, uuid uuid.UUID, secret string, enabledAt *time.Time) error {
+	slog.Info("Updating user TOTP settings", "uuid", uuid, "enabled", enabledAt != nil)
+	query := `
+		UPDATE users
+		SET totp_secret = NULLIF(?1, ''), totp_enabled_at = ?2, totp_last_step = NULL, updated_at = ?3
+		WHERE uuid = ?4`
+
+	return r.execOnUser(ctx, uuid, query, secret, nullTimeValue(enabledAt), timeValue(time.Now()), uuid)
+}
+
+// UseTOTPStep records the time step of an accepted code. It reports false if
+// that step, or a later one, was already used, which stops code replay.
+func (r *UserStorage) UseTOTPStep(ctx context.Context, uuid uuid.UUID, step int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET totp_last_step = ?1
+		WHERE uuid = ?2 AND (totp_last_step IS NULL OR totp_last_step < ?1)`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, step, uuid)
+	if err != nil {
+		slog.Error("Error updating TOTP step", "uuid", uuid, "error", err)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// UpdatePassword stores a new password hash. A new password also satisfies a
+// pending forced reset.
+func (r *UserStorage) UpdatePassword(ctx context.Context, uuid uuid.UUID, hash string, changedAt time.Time) error {
+	slog.Info("Updating user password", "uuid", uuid)
+	query := `
+		UPDATE users
+		SET password_hash = ?1, password_changed_at = ?2, password_reset_required = FALSE, updated_at = ?2
+		WHERE uuid = ?3`
+
+	return r.execOnUser(ctx, uuid, query, hash, timeValue(changedAt), uuid)
+}
+
+// RehashPassword swaps in a new hash of the same password. It only applies
+// while the stored hash is still oldHash, so it cannot undo a password change
+// that happened in the meantime.
+func (r *UserStorage) RehashPassword(ctx context.Context, uuid uuid.UUID, oldHash, newHash string) error {
+	slog.Info("Rehashing user password", "uuid", uuid)
+	query := `UPDATE users SET password_hash = ?1 WHERE uuid = ?2 AND password_hash = ?3`
+
+	return r.execOnUser(ctx, uuid, query, newHash, uuid, oldHash)
+}
+
+func (r *UserStorage) execOnUser(ctx context.Context, uuid uuid.UUID, query string, args ...interface{}) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("Error updating user", "uuid", uuid, "error", err)
+		return mapUniqueViolation(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		slog.Warn("No rows updated", "uuid", uuid)
+		return storage.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *UserStorage) Delete(ctx context.Context, uuid uuid.UUID) error {
+	slog.Info("Deleting user", "uuid", uuid)
+	query := `DELETE FROM users WHERE uuid = ?1`
+
+	return r.execOnUser(ctx, uuid, query, uuid)
+}
+
+func (r *UserStorage) List(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	slog.Info("Listing users", "sort", filter.Sort, "limit", filter.Limit)
+
+	where, args := userFilterConditions(filter, true)
+	query := `SELECT ` + userColumns + ` FROM users` + where + ` ORDER BY ` + userOrderBy(filter.Sort)
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT ?%d`, len(args))
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("Error executing query to list users", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			slog.Error("Error scanning user row", "error", err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating over user rows", "error", err)
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Count returns the number of users matching the filter, ignoring paging.
+func (r *UserStorage) Count(ctx context.Context, filter models.UserFilter) (int, error) {
+	where, args := userFilterConditions(filter, false)
+	query := `SELECT COUNT(*) FROM users` + where
+
+	var count int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		slog.Error("Error counting users", "error", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// userFilterConditions builds the same conditions as the Postgres storage.
+// SQLite's LIKE already ignores ASCII case, standing in for ILIKE.
+func userFilterConditions(filter models.UserFilter, withCursor bool) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Role != "" {
+		addCondition("role = ?%d", filter.Role)
+	}
+	switch filter.Status {
+	case models.UserStatusActive:
+		conditions = append(conditions, "suspended_at IS NULL")
+	case models.UserStatusSuspended:
+		conditions = append(conditions, "suspended_at IS NOT NULL")
+	}
+	if filter.CreatedAfter != nil {
+		addCondition("created_at > ?%d", timeValue(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		addCondition("created_at < ?%d", timeValue(*filter.CreatedBefore))
+	}
+	if filter.UsernamePrefix != "" {
+		addCondition(`username LIKE ?%d ESCAPE '\'`, escapeLike(filter.UsernamePrefix)+"%")
+	}
+	if filter.EmailPrefix != "" {
+		addCondition(`email LIKE ?%d ESCAPE '\'`, escapeLike(filter.EmailPrefix)+"%")
+	}
+	if filter.Query != "" {
+		addCondition(`(username LIKE ?%[1]d ESCAPE '\' OR email LIKE ?%[1]d ESCAPE '\')`, "%"+escapeLike(filter.Query)+"%")
+	}
+
+	if withCursor && filter.After != nil {
+		op := ">"
+		if strings.HasPrefix(filter.Sort, "-") {
+			op = "<"
+		}
+		column, value := "created_at", interface{}(timeValue(filter.After.CreatedAt))
+		if strings.TrimPrefix(filter.Sort, "-") == models.SortUsernameAsc {
+			column, value = "username", filter.After.Username
+		}
+		args = append(args, value, filter.After.UUID)
+		conditions = append(conditions, fmt.Sprintf("(%s, uuid) %s (?%d, ?%d)", column, op, len(args)-1, len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return ` WHERE ` + strings.Join(conditions, " AND "), args
+}
+
+func userOrderBy(sort string) string {
+	switch sort {
+	case models.SortCreatedAtDesc:
+		return "created_at DESC, uuid DESC"
+	case models.SortUsernameAsc:
+		return "username ASC, uuid ASC"
+	case models.SortUsernameDesc:
+		return "username DESC, uuid DESC"
+	default:
+		return "created_at ASC, uuid ASC"
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
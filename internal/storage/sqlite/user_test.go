@@ -0,0 +1,32 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Gezubov/user_service/config"
+	"github.com/Gezubov/user_service/internal/infrastructure/db"
+	"github.com/Gezubov/user_service/internal/service"
+	"github.com/Gezubov/user_service/internal/storage/sqlite"
+	"github.com/Gezubov/user_service/internal/storage/storagetest"
+)
+
+func TestUserStorage(t *testing.T) {
+	storagetest.RunUserStorageTests(t, func(t *testing.T) service.UserStorage {
+		ctx := context.Background()
+		dbConfig := &config.DatabaseConfig{Driver: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "test.db")}
+		if err := db.Migrate(ctx, dbConfig, db.MigrateUp); err != nil {
+			t.Fatalf("apply migrations: %v", err)
+		}
+
+		sqlDB, err := db.OpenSQLite(dbConfig.SQLitePath)
+		if err != nil {
+			t.Fatalf("open database: %v", err)
+		}
+		sqlDB.SetMaxOpenConns(1)
+		t.Cleanup(func() { sqlDB.Close() })
+
+		return sqlite.NewUserStorage(ctx, sqlDB)
+	})
+}
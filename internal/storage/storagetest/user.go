@@ -0,0 +1,638 @@
+// Package storagetest holds behavioral tests shared by every implementation
+// of the storage interfaces, so the backends cannot drift apart.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/Gezubov/user_service/internal/service"
+	"github.com/Gezubov/user_service/internal/storage"
+	"github.com/google/uuid"
+)
+
+// NewUserStorage returns an empty storage for a single test.
+type NewUserStorage func(t *testing.T) service.UserStorage
+
+// errRollback makes WithTx roll back in tests.
+var errRollback = errors.New("rollback")
+
+// RunUserStorageTests checks that a service.UserStorage behaves like the
+// Postgres storage.UserStorage.
+func RunUserStorageTests(t *testing.T, newStorage NewUserStorage) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s service.UserStorage)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"GetMissing", testGetMissing},
+		{"CreateDuplicate", testCreateDuplicate},
+		{"CaseInsensitive", testCaseInsensitive},
+		{"Update", testUpdate},
+		{"UpdateDuplicate", testUpdateDuplicate},
+		{"UpdateMissing", testUpdateMissing},
+		{"Delete", testDelete},
+		{"AdminFlags", testAdminFlags},
+		{"EmailVerification", testEmailVerification},
+		{"TOTP", testTOTP},
+		{"Password", testPassword},
+		{"List", testList},
+		{"ListPagination", testListPagination},
+		{"WithTx", testWithTx},
+		{"ConcurrentCreate", testConcurrentCreate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStorage(t))
+		})
+	}
+}
+
+func newUser(name string) *models.User {
+	return &models.User{
+		Username:     name,
+		Email:        name + "@example.com",
+		PasswordHash: "hash-" + name,
+		Role:         models.RoleUser,
+	}
+}
+
+func mustCreate(t *testing.T, s service.UserStorage, name string) *models.User {
+	t.Helper()
+	user := newUser(name)
+	if err := s.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create(%q): %v", name, err)
+	}
+	return user
+}
+
+func mustGet(t *testing.T, s service.UserStorage, id uuid.UUID) *models.User {
+	t.Helper()
+	user, err := s.GetByUUID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetByUUID: %v", err)
+	}
+	return user
+}
+
+func wantErr(t *testing.T, op string, got, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Fatalf("%s: got error %v, want %v", op, got, want)
+	}
+}
+
+func testCreateAndGet(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+	if user.UUID == uuid.Nil {
+		t.Fatal("Create did not assign a UUID")
+	}
+	if user.CreatedAt.IsZero() || user.UpdatedAt.IsZero() {
+		t.Fatal("Create did not set the timestamps")
+	}
+
+	lookups := map[string]func() (*models.User, error){
+		"GetByUUID":     func() (*models.User, error) { return s.GetByUUID(ctx, user.UUID) },
+		"GetByEmail":    func() (*models.User, error) { return s.GetByEmail(ctx, "alice@example.com") },
+		"GetByUsername": func() (*models.User, error) { return s.GetByUsername(ctx, "alice") },
+	}
+	for name, lookup := range lookups {
+		got, err := lookup()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.UUID != user.UUID || got.Username != "alice" || got.Email != "alice@example.com" ||
+			got.PasswordHash != "hash-alice" || got.Role != models.RoleUser {
+			t.Fatalf("%s returned %+v", name, got)
+		}
+		if got.EmailVerifiedAt != nil || got.SuspendedAt != nil || got.TOTPEnabledAt != nil ||
+			got.PasswordChangedAt != nil || got.PasswordResetRequired || got.PendingEmail != "" {
+			t.Fatalf("%s: new user has unexpected state %+v", name, got)
+		}
+	}
+}
+
+func testGetMissing(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	mustCreate(t, s, "alice")
+
+	_, err := s.GetByUUID(ctx, uuid.New())
+	wantErr(t, "GetByUUID", err, storage.ErrUserNotFound)
+	_, err = s.GetByEmail(ctx, "bob@example.com")
+	wantErr(t, "GetByEmail", err, storage.ErrUserNotFound)
+	_, err = s.GetByUsername(ctx, "bob")
+	wantErr(t, "GetByUsername", err, storage.ErrUserNotFound)
+}
+
+func testCreateDuplicate(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	mustCreate(t, s, "alice")
+
+	sameUsername := newUser("alice")
+	sameUsername.Email = "other@example.com"
+	wantErr(t, "Create with taken username", s.Create(ctx, sameUsername), storage.ErrUsernameTaken)
+
+	sameEmail := newUser("bob")
+	sameEmail.Email = "alice@example.com"
+	wantErr(t, "Create with taken email", s.Create(ctx, sameEmail), storage.ErrEmailTaken)
+
+	count, err := s.Count(ctx, models.UserFilter{})
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("got %d users after failed creates, want 1", count)
+	}
+}
+
+// testCaseInsensitive sticks to ASCII, since SQLite only folds ASCII
+// letters.
+func testCaseInsensitive(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+
+	got, err := s.GetByEmail(ctx, "Alice@Example.COM")
+	if err != nil || got.UUID != user.UUID {
+		t.Fatalf("GetByEmail in other case: got %+v, %v", got, err)
+	}
+	got, err = s.GetByUsername(ctx, "ALICE")
+	if err != nil || got.UUID != user.UUID {
+		t.Fatalf("GetByUsername in other case: got %+v, %v", got, err)
+	}
+
+	sameUsername := newUser("Alice")
+	sameUsername.Email = "other@example.com"
+	wantErr(t, "Create with username in other case", s.Create(ctx, sameUsername), storage.ErrUsernameTaken)
+
+	sameEmail := newUser("bob")
+	sameEmail.Email = "ALICE@example.com"
+	wantErr(t, "Create with email in other case", s.Create(ctx, sameEmail), storage.ErrEmailTaken)
+
+	bob := mustCreate(t, s, "bob")
+	bob.Email = "Alice@example.com"
+	wantErr(t, "Update to email in other case", s.Update(ctx, bob), storage.ErrEmailTaken)
+
+	// Changing only the case of one's own username is not a clash.
+	user.Username = "Alice"
+	if err := s.Update(ctx, user); err != nil {
+		t.Fatalf("Update to own username in other case: %v", err)
+	}
+}
+
+func testUpdate(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+
+	user.Username = "alicia"
+	user.Email = "alicia@example.com"
+	user.PasswordHash = "new-hash"
+	user.Role = models.RoleAdmin
+	if err := s.Update(ctx, user); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	got := mustGet(t, s, user.UUID)
+	if got.Username != "alicia" || got.Email != "alicia@example.com" || got.PasswordHash != "new-hash" ||
+		got.Role != models.RoleAdmin {
+		t.Fatalf("Update stored %+v", got)
+	}
+
+	// Saving a user unchanged does not clash with itself.
+	if err := s.Update(ctx, got); err != nil {
+		t.Fatalf("Update without changes: %v", err)
+	}
+}
+
+func testUpdateDuplicate(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	mustCreate(t, s, "alice")
+	bob := mustCreate(t, s, "bob")
+
+	update := *bob
+	update.Username = "alice"
+	wantErr(t, "Update to taken username", s.Update(ctx, &update), storage.ErrUsernameTaken)
+
+	update = *bob
+	update.Email = "alice@example.com"
+	wantErr(t, "Update to taken email", s.Update(ctx, &update), storage.ErrEmailTaken)
+
+	if got := mustGet(t, s, bob.UUID); got.Username != "bob" || got.Email != "bob@example.com" {
+		t.Fatalf("failed update changed the user: %+v", got)
+	}
+}
+
+func testUpdateMissing(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	missing := uuid.New()
+	now := time.Now()
+
+	user := newUser("ghost")
+	user.UUID = missing
+	wantErr(t, "Update", s.Update(ctx, user), storage.ErrUserNotFound)
+	wantErr(t, "UpdateRole", s.UpdateRole(ctx, missing, models.RoleAdmin), storage.ErrUserNotFound)
+	wantErr(t, "UpdateSuspension", s.UpdateSuspension(ctx, missing, &now), storage.ErrUserNotFound)
+	wantErr(t, "UpdatePasswordResetRequired", s.UpdatePasswordResetRequired(ctx, missing, true), storage.ErrUserNotFound)
+	wantErr(t, "UpdatePassword", s.UpdatePassword(ctx, missing, "hash", now), storage.ErrUserNotFound)
+	wantErr(t, "RehashPassword", s.RehashPassword(ctx, missing, "hash", "new"), storage.ErrUserNotFound)
+	wantErr(t, "UpdatePendingEmail", s.UpdatePendingEmail(ctx, missing, "x@example.com"), storage.ErrUserNotFound)
+	wantErr(t, "MarkEmailVerified", s.MarkEmailVerified(ctx, missing, "x@example.com"), storage.ErrUserNotFound)
+	wantErr(t, "UpdateTOTP", s.UpdateTOTP(ctx, missing, "secret", nil), storage.ErrUserNotFound)
+	wantErr(t, "Delete", s.Delete(ctx, missing), storage.ErrUserNotFound)
+
+	used, err := s.UseTOTPStep(ctx, missing, 1)
+	if err != nil || used {
+		t.Fatalf("UseTOTPStep on a missing user = %v, %v; want false, nil", used, err)
+	}
+}
+
+func testDelete(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	alice := mustCreate(t, s, "alice")
+	bob := mustCreate(t, s, "bob")
+
+	if err := s.Delete(ctx, alice.UUID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err := s.GetByUUID(ctx, alice.UUID)
+	wantErr(t, "GetByUUID after Delete", err, storage.ErrUserNotFound)
+	wantErr(t, "second Delete", s.Delete(ctx, alice.UUID), storage.ErrUserNotFound)
+	mustGet(t, s, bob.UUID)
+
+	// The username and email are free again.
+	mustCreate(t, s, "alice")
+}
+
+func testAdminFlags(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+
+	if err := s.UpdateRole(ctx, user.UUID, models.RoleAdmin); err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	suspendedAt := time.Now().UTC()
+	if err := s.UpdateSuspension(ctx, user.UUID, &suspendedAt); err != nil {
+		t.Fatalf("UpdateSuspension: %v", err)
+	}
+	if err := s.UpdatePasswordResetRequired(ctx, user.UUID, true); err != nil {
+		t.Fatalf("UpdatePasswordResetRequired: %v", err)
+	}
+
+	got := mustGet(t, s, user.UUID)
+	if got.Role != models.RoleAdmin || !got.IsSuspended() || !got.PasswordResetRequired {
+		t.Fatalf("admin updates stored %+v", got)
+	}
+
+	if err := s.UpdateSuspension(ctx, user.UUID, nil); err != nil {
+		t.Fatalf("UpdateSuspension(nil): %v", err)
+	}
+	if got := mustGet(t, s, user.UUID); got.IsSuspended() {
+		t.Fatal("suspension was not lifted")
+	}
+}
+
+func testEmailVerification(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	alice := mustCreate(t, s, "alice")
+	mustCreate(t, s, "bob")
+
+	if err := s.MarkEmailVerified(ctx, alice.UUID, "alice@example.com"); err != nil {
+		t.Fatalf("MarkEmailVerified(current email): %v", err)
+	}
+	if got := mustGet(t, s, alice.UUID); got.EmailVerifiedAt == nil {
+		t.Fatal("email was not marked verified")
+	}
+
+	if err := s.UpdatePendingEmail(ctx, alice.UUID, "new@example.com"); err != nil {
+		t.Fatalf("UpdatePendingEmail: %v", err)
+	}
+	if got := mustGet(t, s, alice.UUID); got.PendingEmail != "new@example.com" || got.Email != "alice@example.com" {
+		t.Fatalf("pending email stored as %+v", got)
+	}
+
+	wantErr(t, "MarkEmailVerified(unrelated email)",
+		s.MarkEmailVerified(ctx, alice.UUID, "unrelated@example.com"), storage.ErrUserNotFound)
+
+	if err := s.MarkEmailVerified(ctx, alice.UUID, "new@example.com"); err != nil {
+		t.Fatalf("MarkEmailVerified(pending email): %v", err)
+	}
+	got := mustGet(t, s, alice.UUID)
+	if got.Email != "new@example.com" || got.PendingEmail != "" || got.EmailVerifiedAt == nil {
+		t.Fatalf("verifying the pending email stored %+v", got)
+	}
+
+	// A pending address may be taken by the time it is verified.
+	if err := s.UpdatePendingEmail(ctx, alice.UUID, "bob@example.com"); err != nil {
+		t.Fatalf("UpdatePendingEmail: %v", err)
+	}
+	wantErr(t, "MarkEmailVerified(taken email)",
+		s.MarkEmailVerified(ctx, alice.UUID, "bob@example.com"), storage.ErrEmailTaken)
+
+	if err := s.UpdatePendingEmail(ctx, alice.UUID, ""); err != nil {
+		t.Fatalf("UpdatePendingEmail(\"\"): %v", err)
+	}
+	if got := mustGet(t, s, alice.UUID); got.PendingEmail != "" {
+		t.Fatalf("pending email not cleared: %q", got.PendingEmail)
+	}
+}
+
+func testTOTP(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+
+	enabledAt := time.Now().UTC()
+	if err := s.UpdateTOTP(ctx, user.UUID, "secret", &enabledAt); err != nil {
+		t.Fatalf("UpdateTOTP: %v", err)
+	}
+	if got := mustGet(t, s, user.UUID); got.TOTPSecret != "secret" || !got.MFAEnabled() {
+		t.Fatalf("UpdateTOTP stored %+v", got)
+	}
+
+	steps := []struct {
+		step int64
+		want bool
+	}{{100, true}, {100, false}, {99, false}, {101, true}}
+	for _, tc := range steps {
+		used, err := s.UseTOTPStep(ctx, user.UUID, tc.step)
+		if err != nil {
+			t.Fatalf("UseTOTPStep(%d): %v", tc.step, err)
+		}
+		if used != tc.want {
+			t.Fatalf("UseTOTPStep(%d) = %v, want %v", tc.step, used, tc.want)
+		}
+	}
+
+	// Re-enrolling forgets the used steps.
+	if err := s.UpdateTOTP(ctx, user.UUID, "other", nil); err != nil {
+		t.Fatalf("UpdateTOTP: %v", err)
+	}
+	if used, err := s.UseTOTPStep(ctx, user.UUID, 50); err != nil || !used {
+		t.Fatalf("UseTOTPStep after re-enrollment = %v, %v; want true, nil", used, err)
+	}
+
+	if err := s.UpdateTOTP(ctx, user.UUID, "", nil); err != nil {
+		t.Fatalf("UpdateTOTP(\"\"): %v", err)
+	}
+	if got := mustGet(t, s, user.UUID); got.TOTPSecret != "" || got.MFAEnabled() {
+		t.Fatalf("disabling TOTP stored %+v", got)
+	}
+}
+
+func testPassword(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+	if err := s.UpdatePasswordResetRequired(ctx, user.UUID, true); err != nil {
+		t.Fatalf("UpdatePasswordResetRequired: %v", err)
+	}
+
+	changedAt := time.Now()
+	if err := s.UpdatePassword(ctx, user.UUID, "changed", changedAt); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	got := mustGet(t, s, user.UUID)
+	if got.PasswordHash != "changed" || got.PasswordResetRequired {
+		t.Fatalf("UpdatePassword stored %+v", got)
+	}
+	if got.PasswordChangedAt == nil || got.PasswordChangedAt.Sub(changedAt).Abs() > time.Millisecond {
+		t.Fatalf("password_changed_at = %v, want %v", got.PasswordChangedAt, changedAt)
+	}
+
+	wantErr(t, "RehashPassword with a stale hash",
+		s.RehashPassword(ctx, user.UUID, "hash-alice", "rehashed"), storage.ErrUserNotFound)
+	if got := mustGet(t, s, user.UUID); got.PasswordHash != "changed" {
+		t.Fatalf("stale rehash overwrote the password: %q", got.PasswordHash)
+	}
+
+	if err := s.RehashPassword(ctx, user.UUID, "changed", "rehashed"); err != nil {
+		t.Fatalf("RehashPassword: %v", err)
+	}
+	if got := mustGet(t, s, user.UUID); got.PasswordHash != "rehashed" {
+		t.Fatalf("RehashPassword stored %q", got.PasswordHash)
+	}
+}
+
+func usernames(users []models.User) []string {
+	names := make([]string, len(users))
+	for i, user := range users {
+		names[i] = user.Username
+	}
+	return names
+}
+
+func testList(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	for _, name := range []string{"carol", "alice", "bob", "alfred", "dave"} {
+		mustCreate(t, s, name)
+	}
+	admin, err := s.GetByUsername(ctx, "bob")
+	if err != nil {
+		t.Fatalf("GetByUsername: %v", err)
+	}
+	if err := s.UpdateRole(ctx, admin.UUID, models.RoleAdmin); err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	suspendedAt := time.Now()
+	dave, err := s.GetByUsername(ctx, "dave")
+	if err != nil {
+		t.Fatalf("GetByUsername: %v", err)
+	}
+	if err := s.UpdateSuspension(ctx, dave.UUID, &suspendedAt); err != nil {
+		t.Fatalf("UpdateSuspension: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter models.UserFilter
+		want   []string
+	}{
+		{"all by username", models.UserFilter{Sort: models.SortUsernameAsc},
+			[]string{"alfred", "alice", "bob", "carol", "dave"}},
+		{"descending", models.UserFilter{Sort: models.SortUsernameDesc},
+			[]string{"dave", "carol", "bob", "alice", "alfred"}},
+		{"by creation", models.UserFilter{Sort: models.SortCreatedAtAsc},
+			[]string{"carol", "alice", "bob", "alfred", "dave"}},
+		{"limit", models.UserFilter{Sort: models.SortUsernameAsc, Limit: 2},
+			[]string{"alfred", "alice"}},
+		{"role", models.UserFilter{Sort: models.SortUsernameAsc, Role: models.RoleAdmin},
+			[]string{"bob"}},
+		{"active", models.UserFilter{Sort: models.SortUsernameAsc, Status: models.UserStatusActive},
+			[]string{"alfred", "alice", "bob", "carol"}},
+		{"suspended", models.UserFilter{Sort: models.SortUsernameAsc, Status: models.UserStatusSuspended},
+			[]string{"dave"}},
+		{"username prefix ignores case", models.UserFilter{Sort: models.SortUsernameAsc, UsernamePrefix: "AL"},
+			[]string{"alfred", "alice"}},
+		{"email prefix", models.UserFilter{Sort: models.SortUsernameAsc, EmailPrefix: "car"},
+			[]string{"carol"}},
+		{"prefix wildcards are literal", models.UserFilter{Sort: models.SortUsernameAsc, UsernamePrefix: "_"},
+			[]string{}},
+		{"query", models.UserFilter{Sort: models.SortUsernameAsc, Query: "LIC"},
+			[]string{"alice"}},
+	}
+
+	for _, tt := range tests {
+		users, err := s.List(ctx, tt.filter)
+		if err != nil {
+			t.Fatalf("%s: List: %v", tt.name, err)
+		}
+		if got := usernames(users); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: List returned %v, want %v", tt.name, got, tt.want)
+		}
+
+		count, err := s.Count(ctx, tt.filter)
+		if err != nil {
+			t.Fatalf("%s: Count: %v", tt.name, err)
+		}
+		wantCount := len(tt.want)
+		if tt.filter.Limit > 0 {
+			wantCount = 5
+		}
+		if count != wantCount {
+			t.Errorf("%s: Count = %d, want %d", tt.name, count, wantCount)
+		}
+	}
+
+	users, err := s.List(ctx, models.UserFilter{Sort: models.SortCreatedAtAsc})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	after := users[2].CreatedAt
+	users, err = s.List(ctx, models.UserFilter{Sort: models.SortCreatedAtAsc, CreatedAfter: &after})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if got := usernames(users); !slices.Equal(got, []string{"alfred", "dave"}) {
+		t.Errorf("created after filter returned %v", got)
+	}
+}
+
+func testListPagination(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	for i := range 7 {
+		mustCreate(t, s, fmt.Sprintf("user%d", i))
+	}
+
+	sorts := []string{models.SortCreatedAtAsc, models.SortCreatedAtDesc, models.SortUsernameAsc, models.SortUsernameDesc}
+	for _, sort := range sorts {
+		all, err := s.List(ctx, models.UserFilter{Sort: sort})
+		if err != nil {
+			t.Fatalf("%s: List: %v", sort, err)
+		}
+
+		var paged []models.User
+		filter := models.UserFilter{Sort: sort, Limit: 3}
+		for {
+			page, err := s.List(ctx, filter)
+			if err != nil {
+				t.Fatalf("%s: List: %v", sort, err)
+			}
+			paged = append(paged, page...)
+			if len(page) < filter.Limit {
+				break
+			}
+			filter.After = models.NewUserCursor(sort, &page[len(page)-1])
+
+			count, err := s.Count(ctx, filter)
+			if err != nil {
+				t.Fatalf("%s: Count: %v", sort, err)
+			}
+			if count != len(all) {
+				t.Fatalf("%s: Count with a cursor = %d, want %d", sort, count, len(all))
+			}
+		}
+
+		if got, want := usernames(paged), usernames(all); !slices.Equal(got, want) {
+			t.Errorf("%s: pages returned %v, want %v", sort, got, want)
+		}
+	}
+}
+
+func testWithTx(t *testing.T, s service.UserStorage) {
+	ctx := context.Background()
+	alice := mustCreate(t, s, "alice")
+
+	err := s.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.Create(ctx, newUser("bob")); err != nil {
+			return err
+		}
+		if err := s.UpdateRole(ctx, alice.UUID, models.RoleAdmin); err != nil {
+			return err
+		}
+		if _, err := s.GetByUsername(ctx, "bob"); err != nil {
+			t.Errorf("transaction does not see its own insert: %v", err)
+		}
+		return s.WithTx(ctx, func(ctx context.Context) error {
+			if err := s.Delete(ctx, alice.UUID); err != nil {
+				return err
+			}
+			return errRollback
+		})
+	})
+	wantErr(t, "WithTx", err, errRollback)
+
+	if got := mustGet(t, s, alice.UUID); got.Role != models.RoleUser {
+		t.Fatalf("rolled back role change is visible: %q", got.Role)
+	}
+	_, err = s.GetByUsername(ctx, "bob")
+	wantErr(t, "GetByUsername after rollback", err, storage.ErrUserNotFound)
+
+	err = s.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.Create(ctx, newUser("bob")); err != nil {
+			return err
+		}
+		return s.UpdateRole(ctx, alice.UUID, models.RoleAdmin)
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if got := mustGet(t, s, alice.UUID); got.Role != models.RoleAdmin {
+		t.Fatalf("committed role change is missing: %q", got.Role)
+	}
+	if _, err := s.GetByUsername(ctx, "bob"); err != nil {
+		t.Fatalf("committed insert is missing: %v", err)
+	}
+
+	// A unique violation inside a transaction surfaces as the typed error.
+	err = s.WithTx(ctx, func(ctx context.Context) error {
+		user := newUser("alice")
+		user.Email = "other@example.com"
+		return s.Create(ctx, user)
+	})
+	wantErr(t, "duplicate Create in WithTx", err, storage.ErrUsernameTaken)
+}
+
+func testConcurrentCreate(t *testing.T, s service.UserStorage) {
+	const attempts = 8
+
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := newUser("alice")
+			user.Email = fmt.Sprintf("alice%d@example.com", i)
+			errs[i] = s.Create(context.Background(), user)
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, storage.ErrUsernameTaken):
+			t.Fatalf("concurrent Create: %v", err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d concurrent creates of the same username succeeded, want 1", created)
+	}
+}
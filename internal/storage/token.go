@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type TokenStorage struct {
+	db  *pgxpool.Pool
+	ctx context.Context
+}
+
+func NewTokenStorage(ctx context.Context, db *pgxpool.Pool) *TokenStorage {
+	return &TokenStorage{ctx: ctx, db: db}
+}
+
+func (r *TokenStorage) Create(ctx context.Context, token *models.RefreshToken) error {
+	slog.Info("Creating refresh token", "user_uuid", token.UserUUID, "family_uuid", token.FamilyUUID)
+	query := `
+		INSERT INTO refresh_tokens (uuid, user_uuid, family_uuid, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	token.UUID = uuid.New()
+	token.CreatedAt = time.Now().UTC()
+	_, err := conn(ctx, r.db).Exec(ctx,
+		query,
+		token.UUID,
+		token.UserUUID,
+		token.FamilyUUID,
+		token.TokenHash,
+		token.ExpiresAt.UTC(),
+		token.CreatedAt,
+	)
+	if err != nil {
+		slog.Error("Error creating refresh token", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *TokenStorage) GetByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+
+	query := `
+		SELECT uuid, user_uuid, family_uuid, token_hash, expires_at, rotated_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1`
+
+	err := conn(ctx, r.db).QueryRow(ctx, query, hash).Scan(
+		&token.UUID,
+		&token.UserUUID,
+		&token.FamilyUUID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.RotatedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		slog.Error("Error fetching refresh token", "error", err)
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// MarkRotated flags the token as used. It reports false when the token was
+// already rotated or revoked, so two concurrent refreshes cannot both win.
+func (r *TokenStorage) MarkRotated(ctx context.Context, tokenUUID uuid.UUID) (bool, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET rotated_at = $1
+		WHERE uuid = $2 AND rotated_at IS NULL AND revoked_at IS NULL`
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, time.Now().UTC(), tokenUUID)
+	if err != nil {
+		slog.Error("Error rotating refresh token", "uuid", tokenUUID, "error", err)
+		return false, err
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+func (r *TokenStorage) RevokeFamily(ctx context.Context, familyUUID uuid.UUID) error {
+	slog.Warn("Revoking refresh token family", "family_uuid", familyUUID)
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = $1
+		WHERE family_uuid = $2 AND revoked_at IS NULL`
+
+	_, err := conn(ctx, r.db).Exec(ctx, query, time.Now().UTC(), familyUUID)
+	if err != nil {
+		slog.Error("Error revoking refresh token family", "family_uuid", familyUUID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *TokenStorage) RevokeAllForUser(ctx context.Context, userUUID uuid.UUID) error {
+	slog.Info("Revoking all refresh tokens of user", "user_uuid", userUUID)
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = $1
+		WHERE user_uuid = $2 AND revoked_at IS NULL`
+
+	_, err := conn(ctx, r.db).Exec(ctx, query, time.Now().UTC(), userUUID)
+	if err != nil {
+		slog.Error("Error revoking user refresh tokens", "user_uuid", userUUID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpired removes refresh tokens that expired before the given moment.
+func (r *TokenStorage) DeleteExpired(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM refresh_tokens WHERE expires_at < $1`
+
+	if _, err := conn(ctx, r.db).Exec(ctx, query, before.UTC()); err != nil {
+		slog.Error("Error deleting expired refresh tokens", "error", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// querier is what the storages need from a connection; both the pool and a
+// transaction provide it.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+type txKey struct{}
+
+// WithTx runs fn in a transaction carried by the context it is given: every
+// storage call made with that context joins the transaction, whichever
+// storage it belongs to. The transaction commits when fn returns nil and
+// rolls back otherwise. Nested calls join the outer transaction.
+func WithTx(ctx context.Context, db *pgxpool.Pool, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// conn returns the transaction in ctx, if any, or else the pool.
+func conn(ctx context.Context, db *pgxpool.Pool) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+const uniqueViolation = "23505"
+
+// mapUniqueViolation turns a unique-constraint error on the users table into
+// ErrUsernameTaken or ErrEmailTaken. Other errors are returned unchanged.
+func mapUniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return err
+	}
+
+	switch {
+	case strings.Contains(pgErr.ConstraintName, "username"):
+		return ErrUsernameTaken
+	case strings.Contains(pgErr.ConstraintName, "email"):
+		return ErrEmailTaken
+	}
+	return err
+}
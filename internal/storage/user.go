@@ -2,7 +2,9 @@ package storage
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 
 	"log/slog"
 	"time"
@@ -10,17 +12,47 @@ import (
 	"github.com/Gezubov/user_service/internal/models"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+const userColumns = `uuid, username, email, password_hash, role, email_verified_at, COALESCE(pending_email, ''),
+	COALESCE(totp_secret, ''), totp_enabled_at, COALESCE(totp_last_step, 0),
+	suspended_at, password_reset_required, password_changed_at, created_at, updated_at`
+
 type UserStorage struct {
-	db  *pgx.Conn
+	db  *pgxpool.Pool
 	ctx context.Context
 }
 
-func NewUserStorage(ctx context.Context, db *pgx.Conn) *UserStorage {
+func NewUserStorage(ctx context.Context, db *pgxpool.Pool) *UserStorage {
 	return &UserStorage{ctx: ctx, db: db}
 }
 
+// WithTx runs fn in a transaction; see the package-level WithTx.
+func (r *UserStorage) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithTx(ctx, r.db, fn)
+}
+
+func scanUser(row pgx.Row, user *models.User) error {
+	return row.Scan(
+		&user.UUID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		&user.EmailVerifiedAt,
+		&user.PendingEmail,
+		&user.TOTPSecret,
+		&user.TOTPEnabledAt,
+		&user.TOTPLastStep,
+		&user.SuspendedAt,
+		&user.PasswordResetRequired,
+		&user.PasswordChangedAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+}
+
 func (r *UserStorage) Create(ctx context.Context, user *models.User) error {
 	slog.Info("Creating user", "username", user.Username)
 	query := `
@@ -28,9 +60,9 @@ func (r *UserStorage) Create(ctx context.Context, user *models.User) error {
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING uuid`
 
-	now := time.Now()
+	now := time.Now().UTC()
 	user.UUID = uuid.New()
-	err := r.db.QueryRow(ctx,
+	err := conn(ctx, r.db).QueryRow(ctx,
 		query,
 		user.UUID,
 		user.Username,
@@ -43,7 +75,7 @@ func (r *UserStorage) Create(ctx context.Context, user *models.User) error {
 
 	if err != nil {
 		slog.Error("Error creating user", "error", err)
-		return err
+		return mapUniqueViolation(err)
 	}
 
 	user.CreatedAt = now
@@ -55,22 +87,13 @@ func (r *UserStorage) GetByUUID(ctx context.Context, uuid uuid.UUID) (*models.Us
 	slog.Info("Getting user with UUID", "uuid", uuid)
 	user := &models.User{}
 
-	query := `
-		SELECT uuid, username, email, password_hash, role, created_at, updated_at
+	query := `SELECT ` + userColumns + `
 		FROM users
 		WHERE uuid = $1`
 
-	err := r.db.QueryRow(ctx, query, uuid).Scan(
-		&user.UUID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	err := scanUser(conn(ctx, r.db).QueryRow(ctx, query, uuid), user)
 
-	if err == sql.ErrNoRows {
+	if errors.Is(err, pgx.ErrNoRows) {
 		slog.Warn("User not found", "uuid", uuid)
 		return nil, ErrUserNotFound
 	}
@@ -86,20 +109,12 @@ func (r *UserStorage) GetByEmail(ctx context.Context, email string) (*models.Use
 	slog.Info("Getting user with email", "email", email)
 	user := &models.User{}
 
-	query := `SELECT uuid, username, email, password_hash, role, created_at, updated_at 
+	query := `SELECT ` + userColumns + `
 	FROM users 
-	WHERE email = $1`
+	WHERE lower(email) = lower($1)`
 
-	err := r.db.QueryRow(ctx, query, email).Scan(
-		&user.UUID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
+	err := scanUser(conn(ctx, r.db).QueryRow(ctx, query, email), user)
+	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrUserNotFound
 	}
 	return user, err
@@ -112,20 +127,20 @@ func (r *UserStorage) Update(ctx context.Context, user *models.User) error {
 		SET username = $1, email = $2, password_hash = $3, role = $4, updated_at = $5
 		WHERE uuid = $6`
 
-	result, err := r.db.Exec(
+	result, err := conn(ctx, r.db).Exec(
 		ctx,
 		query,
 		user.Username,
 		user.Email,
 		user.PasswordHash,
 		user.Role,
-		time.Now(),
+		time.Now().UTC(),
 		user.UUID,
 	)
 	if err != nil {
 		slog.Error("Error updating user", "uuid", user.UUID, "error", err)
 
-		return err
+		return mapUniqueViolation(err)
 	}
 
 	rowsAffected := result.RowsAffected()
@@ -142,11 +157,121 @@ func (r *UserStorage) Update(ctx context.Context, user *models.User) error {
 	return nil
 }
 
+func (r *UserStorage) UpdateRole(ctx context.Context, uuid uuid.UUID, role string) error {
+	slog.Info("Updating user role", "uuid", uuid, "role", role)
+	query := `UPDATE users SET role = $1, updated_at = $2 WHERE uuid = $3`
+
+	return r.execOnUser(ctx, uuid, query, role, time.Now().UTC(), uuid)
+}
+
+// UpdateSuspension suspends the user when suspendedAt is set and lifts the
+// suspension when it is nil.
+func (r *UserStorage) UpdateSuspension(ctx context.Context, uuid uuid.UUID, suspendedAt *time.Time) error {
+	slog.Info("Updating user suspension", "uuid", uuid, "suspended", suspendedAt != nil)
+	query := `UPDATE users SET suspended_at = $1, updated_at = $2 WHERE uuid = $3`
+
+	return r.execOnUser(ctx, uuid, query, utc(suspendedAt), time.Now().UTC(), uuid)
+}
+
+func (r *UserStorage) UpdatePasswordResetRequired(ctx context.Context, uuid uuid.UUID, required bool) error {
+	slog.Info("Updating user password reset flag", "uuid", uuid, "required", required)
+	query := `UPDATE users SET password_reset_required = $1, updated_at = $2 WHERE uuid = $3`
+
+	return r.execOnUser(ctx, uuid, query, required, time.Now().UTC(), uuid)
+}
+
+// UpdatePendingEmail stores an address the user wants to switch to until it
+// is verified. An empty email clears it.
+func (r *UserStorage) UpdatePendingEmail(ctx context.Context, uuid uuid.UUID, email string) error {
+	slog.Info("Updating user pending email", "uuid", uuid)
+	query := `UPDATE users SET pending_email = NULLIF($1, ''), updated_at = $2 WHERE uuid = $3`
+
+	return r.execOnUser(ctx, uuid, query, email, time.Now().UTC(), uuid)
+}
+
+// MarkEmailVerified confirms the given address. When it is the pending one,
+// it replaces the current email.
+func (r *UserStorage) MarkEmailVerified(ctx context.Context, uuid uuid.UUID, email string) error {
+	slog.Info("Marking user email verified", "uuid", uuid)
+	query := `
+		UPDATE users
+		SET email = $1, email_verified_at = $2, pending_email = NULL, updated_at = $2
+		WHERE uuid = $3 AND (email = $1 OR pending_email = $1)`
+
+	return r.execOnUser(ctx, uuid, query, email, time.Now().UTC(), uuid)
+}
+
+// UpdateTOTP stores the user's TOTP secret; enabledAt is nil until the user
+// confirms enrollment. An empty secret disables two-factor authentication.
+func (r *UserStorage) UpdateTOTP(ctx context.Context, uuid uuid.UUID, secret string, enabledAt *time.Time) error {
+	slog.Info("Updating user TOTP settings", "uuid", uuid, "enabled", enabledAt != nil)
+	query := `
+		UPDATE users
+		SET totp_secret = NULLIF($1, ''), totp_enabled_at = $2, totp_last_step = NULL, updated_at = $3
+		WHERE uuid = $4`
+
+	return r.execOnUser(ctx, uuid, query, secret, utc(enabledAt), time.Now().UTC(), uuid)
+}
+
+// UseTOTPStep records the time step of an accepted code. It reports false if
+// that step, or a later one, was already used, which stops code replay.
+func (r *UserStorage) UseTOTPStep(ctx context.Context, uuid uuid.UUID, step int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET totp_last_step = $1
+		WHERE uuid = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+
+	result, err := conn(ctx, r.db).Exec(ctx, query, step, uuid)
+	if err != nil {
+		slog.Error("Error updating TOTP step", "uuid", uuid, "error", err)
+		return false, err
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// UpdatePassword stores a new password hash. A new password also satisfies a
+// pending forced reset.
+func (r *UserStorage) UpdatePassword(ctx context.Context, uuid uuid.UUID, hash string, changedAt time.Time) error {
+	slog.Info("Updating user password", "uuid", uuid)
+	query := `
+		UPDATE users
+		SET password_hash = $1, password_changed_at = $2, password_reset_required = FALSE, updated_at = $2
+		WHERE uuid = $3`
+
+	return r.execOnUser(ctx, uuid, query, hash, changedAt.UTC(), uuid)
+}
+
+// RehashPassword swaps in a new hash of the same password. It only applies
+// while the stored hash is still oldHash, so it cannot undo a password change
+// that happened in the meantime.
+func (r *UserStorage) RehashPassword(ctx context.Context, uuid uuid.UUID, oldHash, newHash string) error {
+	slog.Info("Rehashing user password", "uuid", uuid)
+	query := `UPDATE users SET password_hash = $1 WHERE uuid = $2 AND password_hash = $3`
+
+	return r.execOnUser(ctx, uuid, query, newHash, uuid, oldHash)
+}
+
+func (r *UserStorage) execOnUser(ctx context.Context, uuid uuid.UUID, query string, args ...interface{}) error {
+	result, err := conn(ctx, r.db).Exec(ctx, query, args...)
+	if err != nil {
+		slog.Error("Error updating user", "uuid", uuid, "error", err)
+		return mapUniqueViolation(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		slog.Warn("No rows updated", "uuid", uuid)
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
 func (r *UserStorage) Delete(ctx context.Context, uuid uuid.UUID) error {
 	slog.Info("Deleting user", "uuid", uuid)
 	query := `DELETE FROM users WHERE uuid = $1`
 
-	result, err := r.db.Exec(ctx, query, uuid)
+	result, err := conn(ctx, r.db).Exec(ctx, query, uuid)
 	if err != nil {
 		slog.Error("Error deleting user", "uuid", uuid, "error", err)
 		return err
@@ -165,14 +290,19 @@ func (r *UserStorage) Delete(ctx context.Context, uuid uuid.UUID) error {
 	return nil
 }
 
-func (r *UserStorage) GetAllUsers(ctx context.Context) ([]models.User, error) {
-	slog.Info("Fetching all users from database")
+func (r *UserStorage) List(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	slog.Info("Listing users", "sort", filter.Sort, "limit", filter.Limit)
 
-	query := `SELECT uuid, username, email, role, created_at, updated_at FROM users`
-	rows, err := r.db.Query(ctx, query)
+	where, args := userFilterConditions(filter, true)
+	query := `SELECT ` + userColumns + ` FROM users` + where + ` ORDER BY ` + userOrderBy(filter.Sort)
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
 
+	rows, err := conn(ctx, r.db).Query(ctx, query, args...)
 	if err != nil {
-		slog.Error("Error executing query to fetch users", "error", err)
+		slog.Error("Error executing query to list users", "error", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -180,7 +310,7 @@ func (r *UserStorage) GetAllUsers(ctx context.Context) ([]models.User, error) {
 	users := []models.User{}
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.UUID, &user.Username, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		if err := scanUser(rows, &user); err != nil {
 			slog.Error("Error scanning user row", "error", err)
 			return nil, err
 		}
@@ -196,25 +326,111 @@ func (r *UserStorage) GetAllUsers(ctx context.Context) ([]models.User, error) {
 	return users, nil
 }
 
+// Count returns the number of users matching the filter, ignoring paging.
+func (r *UserStorage) Count(ctx context.Context, filter models.UserFilter) (int, error) {
+	where, args := userFilterConditions(filter, false)
+	query := `SELECT COUNT(*) FROM users` + where
+
+	var count int
+	if err := conn(ctx, r.db).QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		slog.Error("Error counting users", "error", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func userFilterConditions(filter models.UserFilter, withCursor bool) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Role != "" {
+		addCondition("role = $%d", filter.Role)
+	}
+	switch filter.Status {
+	case models.UserStatusActive:
+		conditions = append(conditions, "suspended_at IS NULL")
+	case models.UserStatusSuspended:
+		conditions = append(conditions, "suspended_at IS NOT NULL")
+	}
+	if filter.CreatedAfter != nil {
+		addCondition("created_at > $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		addCondition("created_at < $%d", *filter.CreatedBefore)
+	}
+	if filter.UsernamePrefix != "" {
+		addCondition("username ILIKE $%d", escapeLike(filter.UsernamePrefix)+"%")
+	}
+	if filter.EmailPrefix != "" {
+		addCondition("email ILIKE $%d", escapeLike(filter.EmailPrefix)+"%")
+	}
+	if filter.Query != "" {
+		addCondition("(username ILIKE $%[1]d OR email ILIKE $%[1]d)", "%"+escapeLike(filter.Query)+"%")
+	}
+
+	if withCursor && filter.After != nil {
+		op := ">"
+		if strings.HasPrefix(filter.Sort, "-") {
+			op = "<"
+		}
+		column, value := "created_at", interface{}(filter.After.CreatedAt)
+		if strings.TrimPrefix(filter.Sort, "-") == models.SortUsernameAsc {
+			column, value = "username", filter.After.Username
+		}
+		args = append(args, value, filter.After.UUID)
+		conditions = append(conditions, fmt.Sprintf("(%s, uuid) %s ($%d, $%d)", column, op, len(args)-1, len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return ` WHERE ` + strings.Join(conditions, " AND "), args
+}
+
+func userOrderBy(sort string) string {
+	switch sort {
+	case models.SortCreatedAtDesc:
+		return "created_at DESC, uuid DESC"
+	case models.SortUsernameAsc:
+		return "username ASC, uuid ASC"
+	case models.SortUsernameDesc:
+		return "username DESC, uuid DESC"
+	default:
+		return "created_at ASC, uuid ASC"
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
 func (r *UserStorage) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	slog.Info("Getting user with username", "username", username)
 	user := &models.User{}
 
-	query := `SELECT uuid, username, email, password_hash, role, created_at, updated_at 
+	query := `SELECT ` + userColumns + `
 	FROM users 
-	WHERE username = $1`
+	WHERE lower(username) = lower($1)`
 
-	err := r.db.QueryRow(ctx, query, username).Scan(
-		&user.UUID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
+	err := scanUser(conn(ctx, r.db).QueryRow(ctx, query, username), user)
+	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrUserNotFound
 	}
 	return user, err
 }
+
+// utc returns t in UTC, keeping nil as nil.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
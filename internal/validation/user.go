@@ -0,0 +1,161 @@
+// Package validation checks and normalizes user input before it reaches the
+// service layer. Every rule a field breaks is reported as a
+// models.FieldError, so clients can show all problems at once.
+package validation
+
+import (
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Gezubov/user_service/internal/models"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+	// MaxEmailLength is the longest address that fits the forward-path of
+	// an SMTP command (RFC 5321).
+	MaxEmailLength = 254
+)
+
+// Codes reported in models.FieldError for the username and email fields.
+const (
+	UsernameRequired          = "USERNAME_REQUIRED"
+	UsernameTooShort          = "USERNAME_TOO_SHORT"
+	UsernameTooLong           = "USERNAME_TOO_LONG"
+	UsernameInvalidCharacters = "USERNAME_INVALID_CHARACTERS"
+	UsernameReserved          = "USERNAME_RESERVED"
+	EmailRequired             = "EMAIL_REQUIRED"
+	EmailTooLong              = "EMAIL_TOO_LONG"
+	EmailInvalid              = "EMAIL_INVALID"
+)
+
+// reservedUsernames could be mistaken for the service itself or its staff.
+// They are compared after lower-casing.
+var reservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"root":          true,
+	"system":        true,
+	"superuser":     true,
+	"support":       true,
+	"security":      true,
+	"moderator":     true,
+	"staff":         true,
+	"postmaster":    true,
+	"hostmaster":    true,
+	"webmaster":     true,
+	"abuse":         true,
+	"noreply":       true,
+	"no-reply":      true,
+	"api":           true,
+	"me":            true,
+	"null":          true,
+	"undefined":     true,
+}
+
+// NormalizeUsername trims surrounding space and applies Unicode NFKC, so
+// that look-alike forms such as full-width letters become one username.
+func NormalizeUsername(username string) string {
+	return norm.NFKC.String(strings.TrimSpace(username))
+}
+
+// NormalizeEmail trims surrounding space and lower-cases the address.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Registration normalizes the username and email of input in place and
+// checks them. The password is left to the password policy.
+func Registration(input *models.UserRegister) error {
+	v := &models.ValidationError{}
+
+	input.Username = NormalizeUsername(input.Username)
+	input.Email = NormalizeEmail(input.Email)
+	Username(v, input.Username)
+	Email(v, input.Email)
+
+	return v.Err()
+}
+
+// Update is Registration for partial updates: empty fields mean "unchanged"
+// and are skipped, but a field made only of space is rejected.
+func Update(input *models.UserRegister) error {
+	v := &models.ValidationError{}
+
+	if input.Username != "" {
+		input.Username = NormalizeUsername(input.Username)
+		Username(v, input.Username)
+	}
+	if input.Email != "" {
+		input.Email = NormalizeEmail(input.Email)
+		Email(v, input.Email)
+	}
+
+	return v.Err()
+}
+
+// Username adds to v every rule a normalized username breaks. Usernames are
+// made of letters, digits and the separators ".", "_" and "-", and start and
+// end with a letter or digit.
+func Username(v *models.ValidationError, username string) {
+	if username == "" {
+		v.Add("username", UsernameRequired, "username is required")
+		return
+	}
+
+	length := utf8.RuneCountInString(username)
+	if length < MinUsernameLength {
+		v.Add("username", UsernameTooShort, "username must be at least "+strconv.Itoa(MinUsernameLength)+" characters long")
+	}
+	if length > MaxUsernameLength {
+		v.Add("username", UsernameTooLong, "username must be at most "+strconv.Itoa(MaxUsernameLength)+" characters long")
+	}
+
+	if !validUsernameCharacters(username) {
+		v.Add("username", UsernameInvalidCharacters, "username may only contain letters, digits, \".\", \"_\" and \"-\", and must start and end with a letter or digit")
+	} else if reservedUsernames[strings.ToLower(username)] {
+		v.Add("username", UsernameReserved, "username is reserved")
+	}
+}
+
+func validUsernameCharacters(username string) bool {
+	first, _ := utf8.DecodeRuneInString(username)
+	last, _ := utf8.DecodeLastRuneInString(username)
+	if !isAlphanumeric(first) || !isAlphanumeric(last) {
+		return false
+	}
+
+	for _, r := range username {
+		if !isAlphanumeric(r) && r != '.' && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Email adds to v every rule a normalized email breaks. The address must be
+// a bare RFC 5322 addr-spec: no display name, angle brackets or comments.
+func Email(v *models.ValidationError, email string) {
+	if email == "" {
+		v.Add("email", EmailRequired, "email is required")
+		return
+	}
+	if len(email) > MaxEmailLength {
+		v.Add("email", EmailTooLong, "email must be at most "+strconv.Itoa(MaxEmailLength)+" bytes long")
+		return
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		v.Add("email", EmailInvalid, "email is not a valid address")
+	}
+}
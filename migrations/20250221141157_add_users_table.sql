@@ -35,5 +35,20 @@ EXECUTE FUNCTION update_updated_at_column();
 
 -- +goose Down
 -- +goose StatementBegin
-DROP TABLE IF EXISTS users;
--- +goose StatementEnd
\ No newline at end of file
+
+-- Undo the switch to uuid keys but keep the users themselves. The pgcrypto
+-- extension stays, as other objects in the database may rely on it.
+DROP TRIGGER IF EXISTS set_updated_at ON users;
+DROP FUNCTION IF EXISTS update_updated_at_column();
+
+ALTER TABLE users
+DROP CONSTRAINT IF EXISTS users_pkey;
+
+DROP INDEX IF EXISTS users_id_unique;
+
+ALTER TABLE users
+ADD PRIMARY KEY (id);
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS uuid;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS users_role_idx ON users(role);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_role_idx;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS password_reset_required,
+DROP COLUMN IF EXISTS suspended_at;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255);
+
+ALTER TABLE one_time_tokens
+ADD COLUMN IF NOT EXISTS email VARCHAR(255);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE one_time_tokens
+DROP COLUMN IF EXISTS email;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS pending_email,
+DROP COLUMN IF EXISTS email_verified_at;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64),
+ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+DROP COLUMN IF EXISTS totp_last_step,
+DROP COLUMN IF EXISTS totp_enabled_at,
+DROP COLUMN IF EXISTS totp_secret;
+-- +goose StatementEnd
@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Usernames and emails become unique regardless of case. Accounts that only
+-- differ in case cannot be merged automatically, so the migration stops and
+-- lists them; resolve them by hand and run it again.
+DO $$
+DECLARE
+    collisions TEXT;
+BEGIN
+    SELECT string_agg(format('%s %s: %s', kind, key, accounts), E'\n')
+    INTO collisions
+    FROM (
+        SELECT 'username' AS kind, lower(username) AS key,
+               string_agg(format('%s (%s)', username, uuid), ', ' ORDER BY created_at) AS accounts
+        FROM users
+        GROUP BY lower(username)
+        HAVING count(*) > 1
+        UNION ALL
+        SELECT 'email', lower(email),
+               string_agg(format('%s (%s)', email, uuid), ', ' ORDER BY created_at)
+        FROM users
+        GROUP BY lower(email)
+        HAVING count(*) > 1
+    ) AS c;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION 'users that differ only in case must be resolved first'
+            USING DETAIL = collisions;
+    END IF;
+END
+$$;
+
+-- The index names contain "username" and "email" so that unique violations
+-- still map to ErrUsernameTaken and ErrEmailTaken.
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (lower(username));
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
+
+ALTER TABLE users
+DROP CONSTRAINT IF EXISTS users_username_key,
+DROP CONSTRAINT IF EXISTS users_email_key;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+ADD CONSTRAINT users_username_key UNIQUE (username),
+ADD CONSTRAINT users_email_key UNIQUE (email);
+
+DROP INDEX IF EXISTS users_email_lower_key;
+DROP INDEX IF EXISTS users_username_lower_key;
+-- +goose StatementEnd
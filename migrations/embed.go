@@ -0,0 +1,17 @@
+// Package migrations embeds the goose SQL migrations so that the service
+// binary can apply them itself.
+package migrations
+
+import "embed"
+
+// FS holds the Postgres migrations.
+//
+//go:embed *.sql
+var FS embed.FS
+
+// SQLiteFS holds the SQLite migrations, in the sqlite directory. They build
+// the same schema as the Postgres ones, minus the tables only used by
+// Postgres-backed features such as shared rate limiting.
+//
+//go:embed sqlite/*.sql
+var SQLiteFS embed.FS
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- UUIDs are stored as text and timestamps as fixed-width UTC text
+-- ("2006-01-02 15:04:05.000000"), which compares and sorts correctly.
+CREATE TABLE IF NOT EXISTS users (
+    uuid TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    email TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'user',
+    email_verified_at TEXT,
+    pending_email TEXT,
+    totp_secret TEXT,
+    totp_enabled_at TEXT,
+    totp_last_step INTEGER,
+    suspended_at TEXT,
+    password_reset_required INTEGER NOT NULL DEFAULT 0,
+    password_changed_at TEXT,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    CONSTRAINT users_username_key UNIQUE (username),
+    CONSTRAINT users_email_key UNIQUE (email)
+);
+
+CREATE INDEX IF NOT EXISTS users_role_idx ON users(role);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    uuid TEXT PRIMARY KEY,
+    user_uuid TEXT NOT NULL REFERENCES users(uuid) ON DELETE CASCADE,
+    family_uuid TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    expires_at TEXT NOT NULL,
+    rotated_at TEXT,
+    revoked_at TEXT,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_uuid_idx ON refresh_tokens(family_uuid);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_uuid_idx ON refresh_tokens(user_uuid);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    user_uuid TEXT NOT NULL REFERENCES users(uuid) ON DELETE CASCADE,
+    expires_at TEXT NOT NULL,
+    revoked_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expires_at_idx ON revoked_tokens(expires_at);
+
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_uuid TEXT PRIMARY KEY REFERENCES users(uuid) ON DELETE CASCADE,
+    revoked_before TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS one_time_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_uuid TEXT NOT NULL REFERENCES users(uuid) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    email TEXT,
+    expires_at TEXT NOT NULL,
+    used_at TEXT,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS one_time_tokens_user_uuid_purpose_idx ON one_time_tokens(user_uuid, purpose);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS one_time_tokens;
+DROP TABLE IF EXISTS user_token_revocations;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+-- +goose StatementEnd
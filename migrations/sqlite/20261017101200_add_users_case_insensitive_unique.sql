@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Usernames and emails become unique regardless of case. SQLite cannot list
+-- the accounts in the way, so if an index fails to build, find them with
+--   SELECT lower(email), group_concat(uuid) FROM users
+--   GROUP BY lower(email) HAVING count(*) > 1;
+-- (and likewise for username), resolve them by hand and run it again.
+--
+-- SQLite's lower() only folds ASCII letters, so non-ASCII usernames that
+-- differ only in case are still told apart here. Emails are stored
+-- lower-cased by the service.
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (lower(username));
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_email_lower_key;
+DROP INDEX IF EXISTS users_username_lower_key;
+-- +goose StatementEnd
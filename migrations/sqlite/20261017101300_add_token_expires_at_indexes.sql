@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Expired tokens are pruned periodically by expiry.
+CREATE INDEX IF NOT EXISTS refresh_tokens_expires_at_idx ON refresh_tokens(expires_at);
+CREATE INDEX IF NOT EXISTS one_time_tokens_expires_at_idx ON one_time_tokens(expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS one_time_tokens_expires_at_idx;
+DROP INDEX IF EXISTS refresh_tokens_expires_at_idx;
+-- +goose StatementEnd
@@ -0,0 +1,120 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2idPrefix = "$argon2id$"
+	saltLength     = 16
+	keyLength      = 32
+	// minKeyLength rejects stored hashes too short to be worth comparing
+	// against: an empty key would match every password.
+	minKeyLength = 16
+)
+
+// Argon2id hashes with the given parameters. Memory is in KiB.
+type Argon2id struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+type argon2idHash struct {
+	params Argon2id
+	salt   []byte
+	key    []byte
+}
+
+var ErrInvalidParams = errors.New("passhash: argon2id parameters must be positive")
+
+var b64 = base64.RawStdEncoding
+
+func (a Argon2id) Hash(password string) (string, error) {
+	if err := a.Validate(); err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, keyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (a Argon2id) Verify(password, encoded string) (bool, error) {
+	h, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), h.salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+}
+
+func (a Argon2id) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	h, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return h.params.Memory < a.Memory ||
+		h.params.Iterations < a.Iterations ||
+		h.params.Parallelism < a.Parallelism ||
+		len(h.key) < keyLength
+}
+
+// Validate rejects parameters that would make argon2 panic.
+func (a Argon2id) Validate() error {
+	if a.Memory == 0 || a.Iterations == 0 || a.Parallelism == 0 {
+		return ErrInvalidParams
+	}
+	return nil
+}
+
+// decodeArgon2id parses "$argon2id$v=19$m=...,t=...,p=...$salt$hash".
+func decodeArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("passhash: unsupported argon2 version %q", parts[2])
+	}
+
+	h := &argon2idHash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.params.Memory, &h.params.Iterations, &h.params.Parallelism); err != nil {
+		return nil, fmt.Errorf("passhash: malformed argon2id parameters: %w", err)
+	}
+	if err := h.params.Validate(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if h.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("passhash: malformed argon2id salt: %w", err)
+	}
+	if h.key, err = b64.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("passhash: malformed argon2id hash: %w", err)
+	}
+	if len(h.key) < minKeyLength {
+		return nil, fmt.Errorf("passhash: argon2id hash is %d bytes, want at least %d", len(h.key), minKeyLength)
+	}
+	return h, nil
+}
@@ -0,0 +1,52 @@
+package passhash_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Gezubov/user_service/pkg/passhash"
+)
+
+// testParams keep hashing fast; they are not meant for production.
+var testParams = passhash.Argon2id{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestArgon2idVerify(t *testing.T) {
+	encoded, err := testParams.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	if ok, err := testParams.Verify("correct horse", encoded); !ok || err != nil {
+		t.Errorf("Verify(right password) = %v, %v; want true, nil", ok, err)
+	}
+	if ok, err := testParams.Verify("battery staple", encoded); ok || err != nil {
+		t.Errorf("Verify(wrong password) = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestArgon2idRejectsShortKey(t *testing.T) {
+	encoded, err := testParams.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	prefix := encoded[:strings.LastIndex(encoded, "$")+1]
+
+	tests := []struct {
+		name, key string
+	}{
+		{"empty key", ""},
+		{"15-byte key", "AAAAAAAAAAAAAAAAAAAA"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := testParams.Verify("any password", prefix+tc.key)
+			if ok || err == nil {
+				t.Errorf("Verify = %v, %v; want false and an error", ok, err)
+			}
+			if !testParams.NeedsRehash(prefix + tc.key) {
+				t.Error("NeedsRehash = false, want true")
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Package passhash hashes passwords with bcrypt or argon2id. Argon2id hashes
+// are PHC strings ("$argon2id$v=19$m=65536,t=3,p=2$salt$hash"); bcrypt keeps
+// its own "$2a$cost$..." format, which the PHC specification accepts as is
+// and which existing hashes already use. Each hash records its algorithm and
+// parameters, so hashes made with different settings can be told apart and
+// upgraded.
+package passhash
+
+import (
+	"errors"
+)
+
+var ErrUnknownFormat = errors.New("passhash: unrecognised hash format")
+
+// Scheme is one hashing algorithm with its cost parameters.
+type Scheme interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded.
+	Verify(password, encoded string) (bool, error)
+	// Recognizes reports whether encoded was produced by this algorithm.
+	Recognizes(encoded string) bool
+	// NeedsRehash reports whether encoded, made by this algorithm, uses
+	// weaker parameters than the scheme is configured with.
+	NeedsRehash(encoded string) bool
+}
+
+// Chain hashes new passwords with its preferred scheme and still verifies
+// hashes made by the others. Anything not made by the preferred scheme with
+// its current parameters needs a rehash.
+type Chain struct {
+	preferred Scheme
+	schemes   []Scheme
+}
+
+func NewChain(preferred Scheme, others ...Scheme) *Chain {
+	return &Chain{preferred: preferred, schemes: append([]Scheme{preferred}, others...)}
+}
+
+func (c *Chain) Hash(password string) (string, error) {
+	return c.preferred.Hash(password)
+}
+
+func (c *Chain) Verify(password, encoded string) (bool, error) {
+	scheme := c.schemeFor(encoded)
+	if scheme == nil {
+		return false, ErrUnknownFormat
+	}
+	return scheme.Verify(password, encoded)
+}
+
+func (c *Chain) Recognizes(encoded string) bool {
+	return c.schemeFor(encoded) != nil
+}
+
+func (c *Chain) NeedsRehash(encoded string) bool {
+	if !c.preferred.Recognizes(encoded) {
+		return true
+	}
+	return c.preferred.NeedsRehash(encoded)
+}
+
+func (c *Chain) schemeFor(encoded string) Scheme {
+	for _, scheme := range c.schemes {
+		if scheme.Recognizes(encoded) {
+			return scheme
+		}
+	}
+	return nil
+}
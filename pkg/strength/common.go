@@ -0,0 +1,27 @@
+package strength
+
+// commonPasswords is ordered by frequency in public breach compilations; the
+// rank of a word is its estimated number of guesses.
+var commonPasswords = []string{
+	"password", "123456", "123456789", "qwerty", "12345678", "111111", "1234567890",
+	"1234567", "12345", "123123", "000000", "iloveyou", "1q2w3e4r", "abc123",
+	"qwertyuiop", "654321", "555555", "lovely", "7777777", "welcome", "888888",
+	"princess", "dragon", "password1", "123qwe", "666666", "1qaz2wsx", "333333",
+	"michael", "sunshine", "liverpool", "777777", "1q2w3e", "monkey", "letmein",
+	"football", "baseball", "shadow", "master", "superman", "qwerty123", "charlie",
+	"jordan", "jennifer", "hunter", "buster", "soccer", "harley", "batman",
+	"andrew", "tigger", "trustno1", "thomas", "robert", "access", "love",
+	"ranger", "hockey", "killer", "george", "cookie", "computer", "michelle",
+	"pepper", "daniel", "starwars", "klaster", "summer", "ashley", "nicole",
+	"chelsea", "biteme", "matthew", "yankees", "maggie", "freedom", "whatever",
+	"ginger", "cheese", "hello", "secret", "admin", "administrator", "root",
+	"login", "passw0rd", "pass", "test", "guest", "qazwsx", "zaq12wsx",
+	"asdfgh", "zxcvbnm", "changeme", "default", "user", "letmein1", "welcome1",
+	"password123", "passwort", "motdepasse", "contrasena", "parola", "haslo",
+	"qwertz", "azerty", "spring", "autumn", "winter", "monday", "friday",
+	"january", "august", "october", "december", "samsung", "google", "apple",
+	"orange", "banana", "flower", "purple", "silver", "golden", "diamond",
+	"angel", "blessed", "family", "forever", "friend", "happy", "money",
+	"mustang", "ferrari", "porsche", "corvette", "mercedes", "matrix", "pokemon",
+	"naruto", "minecraft", "fortnite", "zxcvbn", "abcdef", "abcd1234", "qwe123",
+}
@@ -0,0 +1,209 @@
+// Package strength estimates password strength in the spirit of zxcvbn: a
+// password is split into the cheapest combination of patterns an attacker
+// would try (common passwords, words the user supplied, keyboard walks,
+// sequences, repeats) with brute force filling the gaps, and the number of
+// guesses this takes is mapped onto a 0-4 score.
+package strength
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Score thresholds, as log10 of the estimated number of guesses. They follow
+// zxcvbn: 0 is guessable within a thousand tries, 4 needs over 10^10.
+var scoreThresholds = [...]float64{3, 6, 8, 10}
+
+// Score rates password from 0 (trivial) to 4 (strong). userInputs are words
+// an attacker would try first, such as the username and email.
+func Score(password string, userInputs ...string) int {
+	guesses := Log10Guesses(password, userInputs...)
+	for score, threshold := range scoreThresholds {
+		if guesses < threshold {
+			return score
+		}
+	}
+	return len(scoreThresholds)
+}
+
+// Log10Guesses returns log10 of the estimated number of guesses needed to
+// find password.
+func Log10Guesses(password string, userInputs ...string) float64 {
+	runes := []rune(password)
+	n := len(runes)
+	if n == 0 {
+		return 0
+	}
+
+	dictionary := make(map[string]int, len(commonPasswords)+len(userInputs))
+	for rank, word := range commonPasswords {
+		dictionary[word] = rank + 1
+	}
+	for _, input := range userInputs {
+		if input = strings.ToLower(input); len(input) >= minMatchLength {
+			dictionary[input] = 1
+		}
+	}
+
+	// best[i] is the cheapest way to produce the first i runes.
+	best := make([]float64, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = best[i-1] + bruteForceCost
+		for start := 0; start <= i-minMatchLength; start++ {
+			if cost, ok := matchCost(runes[start:i], dictionary); ok {
+				best[i] = math.Min(best[i], best[start]+cost)
+			}
+		}
+	}
+	return best[n]
+}
+
+const minMatchLength = 3
+
+// bruteForceCost is log10 of the guesses per character not covered by any
+// pattern. Like zxcvbn it is deliberately low: real attackers do not try
+// characters uniformly.
+const bruteForceCost = 1.0
+
+// matchCost returns log10 of the guesses for the cheapest pattern that covers
+// all of segment, if any does.
+func matchCost(segment []rune, dictionary map[string]int) (float64, bool) {
+	cost := math.Inf(1)
+
+	lower := strings.ToLower(string(segment))
+	variations := 1.0
+	if lower != string(segment) {
+		variations = 2 // capitalised or mixed case
+	}
+	if rank, ok := dictionary[lower]; ok {
+		cost = math.Min(cost, math.Log10(float64(rank)*variations))
+	}
+	if unleeted := unleet(lower); unleeted != lower {
+		if rank, ok := dictionary[unleeted]; ok {
+			cost = math.Min(cost, math.Log10(float64(rank)*variations*2))
+		}
+	}
+
+	length := float64(len(segment))
+	if isRepeat(segment) {
+		cost = math.Min(cost, math.Log10(float64(charsetSize(segment[:1]))*length))
+	}
+	if ascending, ok := sequenceDirection(segment); ok {
+		base := 26.0
+		if unicode.IsDigit(segment[0]) {
+			base = 10
+		}
+		if !ascending {
+			base *= 2
+		}
+		cost = math.Min(cost, math.Log10(base*length))
+	}
+	if isRecentYear(lower) {
+		cost = math.Min(cost, math.Log10(120))
+	}
+	if len(segment) >= 4 && isKeyboardWalk(lower) {
+		cost = math.Min(cost, math.Log10(40*length))
+	}
+
+	return cost, !math.IsInf(cost, 1)
+}
+
+func isRecentYear(s string) bool {
+	if len(s) != 4 || !(strings.HasPrefix(s, "19") || strings.HasPrefix(s, "20")) {
+		return false
+	}
+	for _, r := range s[2:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return size
+}
+
+func isRepeat(segment []rune) bool {
+	for _, r := range segment[1:] {
+		if r != segment[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// sequenceDirection recognises runs such as "abcd" or "9876".
+func sequenceDirection(segment []rune) (ascending bool, ok bool) {
+	delta := segment[1] - segment[0]
+	if delta != 1 && delta != -1 {
+		return false, false
+	}
+	for i := 2; i < len(segment); i++ {
+		if segment[i]-segment[i-1] != delta {
+			return false, false
+		}
+	}
+	return delta == 1, true
+}
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm", "qazwsxedc"}
+
+func isKeyboardWalk(lower string) bool {
+	for _, row := range keyboardRows {
+		if strings.Contains(row, lower) || strings.Contains(reverse(row), lower) {
+			return true
+		}
+	}
+	return false
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+var leetReplacer = strings.NewReplacer(
+	"4", "a", "@", "a", "8", "b", "3", "e", "6", "g", "1", "i", "!", "i",
+	"0", "o", "5", "s", "$", "s", "7", "t", "+", "t", "2", "z",
+)
+
+func unleet(s string) string {
+	return leetReplacer.Replace(s)
+}
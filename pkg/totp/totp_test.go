@@ -0,0 +1,146 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gezubov/user_service/pkg/totp"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890".
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestCodeRFC6238 checks the SHA1 test vectors of RFC 6238 Appendix B. The
+// RFC lists 8-digit codes; the last 6 digits are the 6-digit code.
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		step int64
+		code string
+	}{
+		{59, 0x1, "94287082"},
+		{1111111109, 0x23523EC, "07081804"},
+		{1111111111, 0x23523ED, "14050471"},
+		{1234567890, 0x273EF07, "89005924"},
+		{2000000000, 0x3F940AA, "69279037"},
+		{20000000000, 0x27BC86AA, "65353130"},
+	}
+
+	for _, tc := range tests {
+		now := time.Unix(tc.unix, 0).UTC()
+		want := tc.code[len(tc.code)-totp.Digits:]
+
+		if step := totp.Step(now); step != tc.step {
+			t.Errorf("Step(%v) = %#x, want %#x", now, step, tc.step)
+		}
+
+		code, err := totp.Code(rfcSecret, now)
+		if err != nil {
+			t.Fatalf("Code(%v): %v", now, err)
+		}
+		if code != want {
+			t.Errorf("Code(%v) = %s, want %s", now, code, want)
+		}
+
+		step, ok := totp.Validate(rfcSecret, want, now, 0)
+		if !ok || step != tc.step {
+			t.Errorf("Validate(%s, %v) = %#x, %v; want %#x, true", want, now, step, ok, tc.step)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totp.Step(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		skew   int
+		ok     bool
+	}{
+		{"current step", 0, 0, true},
+		{"previous step without skew", -1, 0, false},
+		{"previous step", -1, 1, true},
+		{"next step", 1, 1, true},
+		{"two steps behind", -2, 1, false},
+		{"two steps ahead", 2, 1, false},
+		{"two steps behind with wider skew", -2, 2, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			code, err := totp.CodeAt(rfcSecret, current+tc.offset)
+			if err != nil {
+				t.Fatalf("CodeAt: %v", err)
+			}
+
+			step, ok := totp.Validate(rfcSecret, code, now, tc.skew)
+			if ok != tc.ok {
+				t.Fatalf("Validate = %v, want %v", ok, tc.ok)
+			}
+			if ok && step != current+tc.offset {
+				t.Errorf("Validate matched step %d, want %d", step, current+tc.offset)
+			}
+		})
+	}
+}
+
+// TestValidateReportsCodeStep checks that a code reports the step it was
+// issued for, not the current one. While the skew window keeps the code
+// valid, callers comparing the step against the last one used see a replay.
+func TestValidateReportsCodeStep(t *testing.T) {
+	issued := time.Unix(1234567890, 0)
+	code, err := totp.Code(rfcSecret, issued)
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+
+	lastStep, ok := totp.Validate(rfcSecret, code, issued, 1)
+	if !ok {
+		t.Fatal("code rejected at the time it was issued")
+	}
+
+	replayed, ok := totp.Validate(rfcSecret, code, issued.Add(totp.Period), 1)
+	if !ok {
+		t.Fatal("code rejected one step later, within the skew window")
+	}
+	if replayed != lastStep {
+		t.Errorf("replayed code matched step %d, want the used step %d", replayed, lastStep)
+	}
+
+	if _, ok := totp.Validate(rfcSecret, code, issued.Add(2*totp.Period), 1); ok {
+		t.Error("code accepted two steps later, outside the skew window")
+	}
+}
+
+func TestValidateRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"short code", rfcSecret, "28708"},
+		{"long code", rfcSecret, "94287082"},
+		{"wrong code", rfcSecret, "000000"},
+		{"invalid secret", "not base32!", "287082"},
+		{"empty secret", "", "287082"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, ok := totp.Validate(tc.secret, tc.code, now, 1); ok {
+				t.Errorf("Validate(%q, %q) accepted", tc.secret, tc.code)
+			}
+		})
+	}
+}
+
+func TestValidateTrimsSpace(t *testing.T) {
+	now := time.Unix(59, 0)
+	if _, ok := totp.Validate(strings.ToLower(rfcSecret), " 287082 ", now, 0); !ok {
+		t.Error("Validate rejected a code with surrounding space and a lower-case secret")
+	}
+}